@@ -0,0 +1,215 @@
+package restTest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// DefaultAnomalyWindow is the default number of previous observations
+	// a value is compared with.
+	DefaultAnomalyWindow = 30
+	// DefaultAnomalyThreshold is the default score above which a value is
+	// flagged. 3.5 is the usual cut-off for modified z-scores.
+	DefaultAnomalyThreshold = 3.5
+	// Minimum number of previous observations needed to score a value.
+	minAnomalyBaseline = 5
+	// Scales the median absolute deviation to the standard deviation of
+	// normally distributed data.
+	madScale = 0.6745
+)
+
+// AnomalyMethod is the statistic used to score values against their window.
+type AnomalyMethod int
+
+// Anomaly detection methods.
+const (
+	// MAD scores values by their modified z-score: the distance from the
+	// window's median in median absolute deviations. Robust to outliers in
+	// the window.
+	MAD AnomalyMethod = iota
+	// ZScore scores values by their distance from the window's mean in
+	// standard deviations.
+	ZScore
+)
+
+// AnomalyOptions configures anomaly detection. Zero values use the defaults.
+type AnomalyOptions struct {
+	// Number of previous observations each value is compared with.
+	Window int
+	// Score above which a value is flagged.
+	Threshold float64
+	Method    AnomalyMethod
+}
+
+// Anomaly is an unusual daily net change or transaction amount.
+type Anomaly struct {
+	Date Date
+	// Ledger of the flagged transaction. Empty for daily net changes.
+	Ledger string
+	// The flagged transaction. nil for daily net changes.
+	Transaction *Transaction
+	// The flagged value and the window's center (median or mean) it's compared with.
+	Amount   money.Amount
+	Expected money.Amount
+	// Absolute score of the value.
+	Score float64
+	// Why the value was flagged.
+	Reason string
+}
+
+// Anomalies is a list of anomalies sorted by date.
+type Anomalies []Anomaly
+
+// Returns the anomalies formatted as date and reason, one per line.
+func (as Anomalies) String() string {
+	var s []string
+	for _, a := range as {
+		s = append(s, fmt.Sprintf("%s:\t%s", a.Date.Format(dateTemplate), a.Reason))
+	}
+	return strings.Join(s, "\n")
+}
+
+// DetectAnomalies flags unusual days and transactions. It scores each day's
+// net change against the net changes of the previous opts.Window days with
+// transactions, and each transaction's amount against the previous
+// opts.Window amounts of its ledger. Values with a score above opts.Threshold
+// are flagged. Values with fewer than 5 previous observations, or whose
+// window doesn't vary, aren't scored.
+func DetectAnomalies(ts []Transaction, opts AnomalyOptions) Anomalies {
+	if opts.Window < 1 {
+		opts.Window = DefaultAnomalyWindow
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultAnomalyThreshold
+	}
+
+	sorted := make([]Transaction, len(ts))
+	copy(sorted, ts)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date.Time) })
+
+	var as Anomalies
+
+	// Daily net changes
+	db := DailyBalancesFromTransactions(Slice(sorted))
+	changes := make([]float64, len(db.days))
+	for i, d := range db.days {
+		changes[i] = float64(db.balances[d])
+		if i > 0 {
+			changes[i] -= float64(db.balances[db.days[i-1]])
+		}
+	}
+	for i, d := range db.days {
+		center, score, ok := anomalyScore(changes, i, opts)
+		if !ok || score <= opts.Threshold {
+			continue
+		}
+		as = append(as, Anomaly{
+			Date:     d,
+			Amount:   money.Amount(changes[i]),
+			Expected: money.FromFloat(center / 100),
+			Score:    score,
+			Reason: fmt.Sprintf("daily net change %s is %.1f deviations from the usual %s",
+				money.Amount(changes[i]), score, money.FromFloat(center/100)),
+		})
+	}
+
+	// Transaction amounts per ledger
+	ledgers := make(map[string][]int)
+	for i, t := range sorted {
+		ledgers[t.Ledger] = append(ledgers[t.Ledger], i)
+	}
+	for ledger, indexes := range ledgers {
+		amounts := make([]float64, len(indexes))
+		for j, i := range indexes {
+			amounts[j] = float64(sorted[i].Amount)
+		}
+		for j, i := range indexes {
+			center, score, ok := anomalyScore(amounts, j, opts)
+			if !ok || score <= opts.Threshold {
+				continue
+			}
+			t := sorted[i]
+			name := ledger
+			if name == "" {
+				name = uncategorized
+			}
+			as = append(as, Anomaly{
+				Date:        t.Date,
+				Ledger:      ledger,
+				Transaction: &t,
+				Amount:      t.Amount,
+				Expected:    money.FromFloat(center / 100),
+				Score:       score,
+				Reason: fmt.Sprintf("%s transaction %s at %s is %.1f deviations from the usual %s",
+					name, t.Amount, t.Company, score, money.FromFloat(center/100)),
+			})
+		}
+	}
+
+	sort.SliceStable(as, func(i, j int) bool {
+		if !as[i].Date.Equal(as[j].Date.Time) {
+			return as[i].Date.Before(as[j].Date.Time)
+		}
+		return as[i].Score > as[j].Score
+	})
+	return as
+}
+
+// Scores values[i] against the window of values before it. Returns the
+// window's center and the absolute score, or false if it can't be scored.
+func anomalyScore(values []float64, i int, opts AnomalyOptions) (center, score float64, ok bool) {
+	start := i - opts.Window
+	if start < 0 {
+		start = 0
+	}
+	window := values[start:i]
+	if len(window) < minAnomalyBaseline {
+		return 0, 0, false
+	}
+
+	var spread float64
+	if opts.Method == ZScore {
+		center, spread = meanStdDev(window)
+	} else {
+		center = median(window)
+		deviations := make([]float64, len(window))
+		for j, v := range window {
+			deviations[j] = math.Abs(v - center)
+		}
+		spread = median(deviations) / madScale
+	}
+	if spread == 0 {
+		return center, 0, false
+	}
+	return center, math.Abs(values[i]-center) / spread, true
+}
+
+// Returns the median of the values without modifying them.
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Returns the mean and population standard deviation of the values.
+func meanStdDev(values []float64) (mean, stdDev float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		stdDev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stdDev / float64(len(values)))
+}
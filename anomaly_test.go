@@ -0,0 +1,80 @@
+package restTest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Returns a month of Office and Equipment expenses with a spike on the 20th.
+func anomalyTransactions() []Transaction {
+	var ts []Transaction
+	for day := 1; day <= 28; day++ {
+		d := newDate("2013-12-01").AddDate(0, 0, day-1)
+		ts = append(ts,
+			Transaction{Date{d}, "Office Expense", money.Amount(-4000 - 100*(day%5)), "FEDEX"},
+			Transaction{Date{d}, "Equipment Expense", money.Amount(-50000 - 1000*(day%4)), "BEST BUY"},
+		)
+	}
+	ts = append(ts, Transaction{newDate("2013-12-20"), "Equipment Expense", -551817, "APPLE STORE #R280 VANCOUVER BC"})
+	return ts
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	for _, method := range []AnomalyMethod{MAD, ZScore} {
+		as := DetectAnomalies(anomalyTransactions(), AnomalyOptions{Method: method})
+
+		var day, transaction bool
+		for _, a := range as {
+			if a.Date.Format(dateTemplate) != "2013-12-20" {
+				t.Errorf("Expected only 2013-12-20 to be flagged, got %s", a.Reason)
+				continue
+			}
+			if a.Transaction == nil {
+				day = true
+			} else if a.Transaction.Amount == -551817 && a.Ledger == "Equipment Expense" {
+				transaction = true
+			}
+		}
+		if !day {
+			t.Errorf("Expected method %d to flag the daily net change of 2013-12-20:\n%s", method, as)
+		}
+		if !transaction {
+			t.Errorf("Expected method %d to flag the 5518.17 equipment purchase:\n%s", method, as)
+		}
+	}
+}
+
+func TestDetectAnomaliesNotEnoughData(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-01"), "Office Expense", -100, "FEDEX"},
+		{newDate("2013-12-02"), "Office Expense", -100, "FEDEX"},
+		{newDate("2013-12-03"), "Office Expense", -100000, "FEDEX"},
+	}
+	if as := DetectAnomalies(ts, AnomalyOptions{}); len(as) != 0 {
+		t.Errorf("Expected no anomalies without enough history, got:\n%s", as)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		in       []float64
+		expected float64
+	}{
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tc := range tests {
+		if actual := median(tc.in); actual != tc.expected {
+			t.Errorf("Expected median %f, got %f", tc.expected, actual)
+		}
+	}
+}
+
+func TestMeanStdDev(t *testing.T) {
+	mean, stdDev := meanStdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if mean != 5 || math.Abs(stdDev-2) > 1e-9 {
+		t.Errorf("Expected mean 5 and standard deviation 2, got %f and %f", mean, stdDev)
+	}
+}
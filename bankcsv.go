@@ -0,0 +1,207 @@
+package restTest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mujz/restTest/money"
+)
+
+// CSVMapping describes the layout of a bank's CSV export. Columns are
+// referred to by their name in the header row.
+type CSVMapping struct {
+	// Columns holding the transaction's fields. Ledger and Company are optional.
+	Date    string `json:"date"`
+	Ledger  string `json:"ledger"`
+	Company string `json:"company"`
+	// Column holding signed amounts. Leave it empty when debits and
+	// credits are in separate columns.
+	Amount string `json:"amount"`
+	// Columns holding unsigned outflows and inflows. Used when Amount is empty.
+	Debit  string `json:"debit"`
+	Credit string `json:"credit"`
+	// Layout of the dates as accepted by time.Parse. Defaults to 2006-01-02.
+	DateFormat string `json:"dateFormat"`
+	// Decimal separator of the amounts, "." (default) or ",". The other one is
+	// taken to be the thousands separator and ignored.
+	DecimalSeparator string `json:"decimalSeparator"`
+	// Field delimiter, a single character. Defaults to ",".
+	Delimiter string `json:"delimiter"`
+	// Number of rows before the header row to skip (ex. account details).
+	SkipRows int `json:"skipRows"`
+	// Negate the amounts. For banks that report outflows as positive numbers.
+	FlipSign bool `json:"flipSign"`
+}
+
+// LoadCSVMapping reads a CSVMapping from a JSON file.
+func LoadCSVMapping(path string) (CSVMapping, error) {
+	var m CSVMapping
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Parses a bank amount using the mapping's decimal separator. Empty
+// strings are 0 so that blank debit or credit cells can be read.
+func (m CSVMapping) parseAmount(s string) (money.Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	thousands := ","
+	if m.DecimalSeparator == "," {
+		thousands = "."
+	}
+	s = strings.Replace(s, thousands, "", -1)
+	s = strings.Replace(s, m.DecimalSeparator, ".", 1)
+	return money.Parse(s)
+}
+
+// ParseBankCSV parses the transactions of a bank's CSV export according to
+// the mapping.
+func ParseBankCSV(r io.Reader, m CSVMapping) ([]Transaction, error) {
+	if m.DateFormat == "" {
+		m.DateFormat = dateTemplate
+	}
+	if m.DecimalSeparator == "" {
+		m.DecimalSeparator = "."
+	}
+	if m.Date == "" || (m.Amount == "" && m.Debit == "" && m.Credit == "") {
+		return nil, fmt.Errorf("csv mapping must name the date column and either the amount or the debit and credit columns")
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	if m.Delimiter != "" {
+		if utf8.RuneCountInString(m.Delimiter) != 1 {
+			return nil, fmt.Errorf("csv mapping delimiter must be a single character, got %q", m.Delimiter)
+		}
+		cr.Comma = []rune(m.Delimiter)[0]
+	}
+
+	for i := 0; i < m.SkipRows; i++ {
+		if _, err := cr.Read(); err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+
+	// Column index of each mapped field. -1 if it isn't mapped.
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := index[name]
+		if !ok {
+			return -1, fmt.Errorf("missing column %q", name)
+		}
+		return i, nil
+	}
+	var cols [6]int
+	for i, name := range []string{m.Date, m.Ledger, m.Company, m.Amount, m.Debit, m.Credit} {
+		if cols[i], err = column(name); err != nil {
+			return nil, err
+		}
+	}
+	date, ledger, company, amount, debit, credit := cols[0], cols[1], cols[2], cols[3], cols[4], cols[5]
+
+	// Returns the row's cell in column i or "" if it isn't mapped or the row is short
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var ts []Transaction
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		// Skip blank rows and footers
+		if cell(row, date) == "" {
+			continue
+		}
+
+		t := Transaction{Ledger: cell(row, ledger), Company: cell(row, company)}
+		tm, err := time.Parse(m.DateFormat, cell(row, date))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		t.Date = Date{tm}
+
+		if amount >= 0 {
+			t.Amount, err = m.parseAmount(cell(row, amount))
+		} else {
+			var out, in money.Amount
+			if out, err = m.parseAmount(cell(row, debit)); err == nil {
+				in, err = m.parseAmount(cell(row, credit))
+			}
+			// Some banks sign their debits, others don't
+			if out < 0 {
+				out = -out
+			}
+			t.Amount = in - out
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if m.FlipSign {
+			t.Amount = -t.Amount
+		}
+		ts = append(ts, t)
+	}
+
+	return ts, nil
+}
+
+// BankCSVFile is a Source that reads a bank's CSV export according to Mapping.
+type BankCSVFile struct {
+	reader
+	Path    string
+	Mapping CSVMapping
+}
+
+// Transactions implements Source.
+func (b *BankCSVFile) Transactions() chan []Transaction {
+	return b.start(func(ch chan []Transaction) error {
+		f, err := os.Open(b.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		ts, err := ParseBankCSV(f, b.Mapping)
+		if err != nil {
+			return fmt.Errorf("%s: %v", b.Path, err)
+		}
+		sendBatches(ch, ts)
+		return nil
+	})
+}
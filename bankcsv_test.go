@@ -0,0 +1,94 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBankCSV(t *testing.T) {
+	tests := []struct {
+		input    string
+		mapping  CSVMapping
+		expected []Transaction
+	}{
+		// Signed amounts
+		{
+			"Posted,Description,Amount\n2013-12-22,SHAW CABLESYSTEMS,-110.71\n",
+			CSVMapping{Date: "Posted", Company: "Description", Amount: "Amount"},
+			[]Transaction{{newDate("2013-12-22"), "", -11071, "SHAW CABLESYSTEMS"}},
+		},
+		// Separate debit and credit columns, comma decimals and a preamble
+		{
+			"Account;123\n\nDatum;Omschrijving;Af;Bij;Categorie\n" +
+				"22-12-2013;SHAW;1.110,71;;Phone\n23-12-2013;PAYROLL;;500,00;Income\n",
+			CSVMapping{
+				Date: "Datum", Company: "Omschrijving", Ledger: "Categorie", Debit: "Af", Credit: "Bij",
+				DateFormat: "02-01-2006", DecimalSeparator: ",", Delimiter: ";", SkipRows: 1,
+			},
+			[]Transaction{
+				{newDate("2013-12-22"), "Phone", -111071, "SHAW"},
+				{newDate("2013-12-23"), "Income", 50000, "PAYROLL"},
+			},
+		},
+		// Outflows reported as positive numbers
+		{
+			"Date,Amount\n12/22/2013,110.71\n",
+			CSVMapping{Date: "Date", Amount: "Amount", DateFormat: "01/02/2006", FlipSign: true},
+			[]Transaction{{newDate("2013-12-22"), "", -11071, ""}},
+		},
+	}
+
+	for _, tc := range tests {
+		ts, err := ParseBankCSV(strings.NewReader(tc.input), tc.mapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ts) != len(tc.expected) {
+			t.Fatalf("Expected %d transactions, got %d", len(tc.expected), len(ts))
+		}
+		for i, e := range tc.expected {
+			if a := ts[i]; a.String() != e.String() {
+				t.Errorf("Expected transaction %v\nGot %v", e, a)
+			}
+		}
+	}
+}
+
+func TestParseBankCSVInvalid(t *testing.T) {
+	tests := []struct {
+		input   string
+		mapping CSVMapping
+	}{
+		{"Date,Amount\n2013-12-22,1.00\n", CSVMapping{Date: "Date"}},
+		{"Date,Amount\n2013-12-22,1.00\n", CSVMapping{Date: "Posted", Amount: "Amount"}},
+		{"Date,Amount\n22/12/2013,1.00\n", CSVMapping{Date: "Date", Amount: "Amount"}},
+		{"Date,Amount\n2013-12-22,abc\n", CSVMapping{Date: "Date", Amount: "Amount"}},
+	}
+
+	for _, tc := range tests {
+		if _, err := ParseBankCSV(strings.NewReader(tc.input), tc.mapping); err == nil {
+			t.Errorf("Expected parsing %q with %+v to fail", tc.input, tc.mapping)
+		}
+	}
+
+	// Delimiters of more than one character aren't cut to their first
+	for _, d := range []string{"; ", "\t\t"} {
+		input := strings.Replace("Date,Amount\n2013-12-22,1.00\n", ",", d, -1)
+		_, err := ParseBankCSV(strings.NewReader(input), CSVMapping{Date: "Date", Amount: "Amount", Delimiter: d})
+		if err == nil || !strings.Contains(err.Error(), "delimiter") {
+			t.Errorf("Expected delimiter %q to be rejected, got %v", d, err)
+		}
+	}
+}
+
+func TestLoadCSVMapping(t *testing.T) {
+	path := writeTemp(t, "mapping.json", `{"date": "Posted", "amount": "Amount", "decimalSeparator": ",", "flipSign": true}`)
+
+	m, err := LoadCSVMapping(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (CSVMapping{Date: "Posted", Amount: "Amount", DecimalSeparator: ",", FlipSign: true}); m != expected {
+		t.Errorf("Expected mapping %+v, got %+v", expected, m)
+	}
+}
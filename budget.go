@@ -0,0 +1,162 @@
+package restTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Budgets maps ledgers to their monthly spending budget, as a positive amount.
+type Budgets map[string]money.Amount
+
+// LoadBudgets reads budgets from a JSON file holding an object of ledger
+// names and amounts. Ex. {"Office Expense": "500.00"}
+func LoadBudgets(path string) (Budgets, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var budgets Budgets
+	if err = json.Unmarshal(b, &budgets); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for ledger, amount := range budgets {
+		if amount < 0 {
+			return nil, fmt.Errorf("%s: %s budget must not be negative", path, ledger)
+		}
+	}
+	return budgets, nil
+}
+
+// BudgetLine compares a ledger's budget with its actual spend.
+type BudgetLine struct {
+	Ledger string
+	Budget money.Amount
+	// Spend so far, as a positive amount. Refunds reduce it.
+	Actual money.Amount
+	// Budget left. Negative once the budget is exceeded.
+	Variance money.Amount
+	// Actual spend in percent of the budget.
+	PercentUsed float64
+	// Spend by the end of the month if it continues at the same daily rate.
+	Projected money.Amount
+}
+
+// Exceeded reports whether the actual spend is over budget.
+func (l BudgetLine) Exceeded() bool {
+	return l.Actual > l.Budget
+}
+
+// ProjectedOverspend returns how much the projected spend exceeds the
+// budget by, or 0 if it doesn't.
+func (l BudgetLine) ProjectedOverspend() money.Amount {
+	if l.Projected > l.Budget {
+		return l.Projected - l.Budget
+	}
+	return 0
+}
+
+// BudgetReport compares a month's budgets with the actual spend.
+type BudgetReport struct {
+	// First day of the month.
+	Month Date
+	// Last day included in the actual spend.
+	AsOf Date
+	// One line per budgeted ledger, sorted by ledger.
+	Lines []BudgetLine
+}
+
+// Exceeded returns the lines whose actual spend is over budget.
+func (r BudgetReport) Exceeded() []BudgetLine {
+	var lines []BudgetLine
+	for _, l := range r.Lines {
+		if l.Exceeded() {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// Returns the report formatted as a table. Lines over budget are marked
+// OVER, and those projected to go over are marked PROJECTED OVER.
+func (r BudgetReport) String() string {
+	s := []string{
+		fmt.Sprintf("Budgets %s as of %s", r.Month.Format("2006-01"), r.AsOf.Format(dateTemplate)),
+		fmt.Sprintf("%-40s %12s %12s %12s %7s %12s", "Ledger", "Budget", "Actual", "Variance", "Used", "Projected"),
+	}
+	for _, l := range r.Lines {
+		line := fmt.Sprintf("%-40s %12s %12s %12s %6.1f%% %12s",
+			l.Ledger, l.Budget, l.Actual, l.Variance, l.PercentUsed, l.Projected)
+		if l.Exceeded() {
+			line += "  OVER"
+		} else if l.ProjectedOverspend() > 0 {
+			line += "  PROJECTED OVER"
+		}
+		s = append(s, line)
+	}
+	return strings.Join(s, "\n")
+}
+
+// CompareBudgets compares the budgets with the spend of the month's
+// transactions up to asOf. The month is given by any of its days. If asOf is
+// the zero date, it's the last transaction's date in the month, or the end of
+// the month if there are transactions after it; if it's after the month, the
+// whole month is included and the projection is the actual spend.
+func CompareBudgets(ts []Transaction, budgets Budgets, month, asOf Date) BudgetReport {
+	start := monthOf(month)
+	end := Date{start.AddDate(0, 1, -1)}
+
+	if asOf.IsZero() {
+		asOf = start
+		for _, t := range ts {
+			if t.Date.After(asOf.Time) {
+				asOf = t.Date
+			}
+		}
+	}
+	if asOf.After(end.Time) {
+		asOf = end
+	}
+
+	spend := make(map[string]money.Amount)
+	for _, t := range ts {
+		if t.Date.Before(start.Time) || t.Date.After(asOf.Time) {
+			continue
+		}
+		spend[t.Ledger] -= t.Amount
+	}
+
+	var (
+		r       = BudgetReport{Month: start, AsOf: asOf}
+		elapsed = asOf.Day()
+		days    = end.Day()
+	)
+	for ledger, budget := range budgets {
+		l := BudgetLine{
+			Ledger:    ledger,
+			Budget:    budget,
+			Actual:    spend[ledger],
+			Variance:  budget - spend[ledger],
+			Projected: money.Amount(int64(spend[ledger]) * int64(days) / int64(elapsed)),
+		}
+		if budget != 0 {
+			l.PercentUsed = float64(l.Actual) / float64(budget) * 100
+		}
+		r.Lines = append(r.Lines, l)
+	}
+	sort.Slice(r.Lines, func(i, j int) bool { return r.Lines[i].Ledger < r.Lines[j].Ledger })
+
+	return r
+}
+
+// ParseMonth parses a month in layout 2006-01 into its first day.
+func ParseMonth(s string) (Date, error) {
+	t, err := time.Parse("2006-01", s)
+	return Date{t}, err
+}
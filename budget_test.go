@@ -0,0 +1,93 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestCompareBudgets(t *testing.T) {
+	budgets, err := LoadBudgets(writeTemp(t, "budgets.json", `{
+		"Office Expense": "100.00",
+		"Equipment Expense": "1000",
+		"Travel Expense": "200.00"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := []Transaction{
+		{newDate("2013-11-30"), "Office Expense", -100000, "FEDEX"},
+		{newDate("2013-12-02"), "Office Expense", -4000, "FEDEX"},
+		{newDate("2013-12-05"), "Equipment Expense", -120000, "APPLE STORE"},
+		{newDate("2013-12-06"), "Equipment Expense", 20000, "APPLE STORE REFUND"},
+		{newDate("2013-12-10"), "Office Expense", -1000, "DHL"},
+		{newDate("2014-01-01"), "Office Expense", -100000, "FEDEX"},
+	}
+
+	// The month in progress, without the next month's transaction
+	r := CompareBudgets(ts[:len(ts)-1], budgets, newDate("2013-12-15"), Date{})
+	if d := r.AsOf.Format(dateTemplate); d != "2013-12-10" {
+		t.Errorf("Expected report as of the last transaction 2013-12-10, got %s", d)
+	}
+
+	expected := []BudgetLine{
+		{"Equipment Expense", 100000, 100000, 0, 100, 310000},
+		{"Office Expense", 10000, 5000, 5000, 50, 15500},
+		{"Travel Expense", 20000, 0, 20000, 0, 0},
+	}
+	if len(r.Lines) != len(expected) {
+		t.Fatalf("Expected %d budget lines, got %d", len(expected), len(r.Lines))
+	}
+	for i, e := range expected {
+		if a := r.Lines[i]; a != e {
+			t.Errorf("Expected budget line %+v\nGot %+v", e, a)
+		}
+	}
+
+	if over := r.Exceeded(); len(over) != 0 {
+		t.Errorf("Expected no budget exceeded, got %v", over)
+	}
+	if o := r.Lines[1].ProjectedOverspend(); o != money.Amount(5500) {
+		t.Errorf("Expected office projected overspend 55.00, got %s", o)
+	}
+	if !strings.Contains(r.String(), "PROJECTED OVER") {
+		t.Errorf("Expected projected overspend to be marked, got:\n%s", r)
+	}
+
+	// The whole month, after an overspend
+	r = CompareBudgets(ts, Budgets{"Office Expense": 1000}, newDate("2013-12-01"), newDate("2014-02-01"))
+	if d := r.AsOf.Format(dateTemplate); d != "2013-12-31" {
+		t.Errorf("Expected report as of the end of the month, got %s", d)
+	}
+	if over := r.Exceeded(); len(over) != 1 || over[0].Projected != over[0].Actual {
+		t.Errorf("Expected office budget to be exceeded with a projection equal to the actual spend, got %v", over)
+	}
+	// A past month, with transactions after it
+	r = CompareBudgets(ts, budgets, newDate("2013-12-01"), Date{})
+	if d := r.AsOf.Format(dateTemplate); d != "2013-12-31" {
+		t.Errorf("Expected report of a past month as of its end, got %s", d)
+	}
+	for _, l := range r.Lines {
+		if l.Projected != l.Actual {
+			t.Errorf("Expected %s projection %s to equal the actual spend %s", l.Ledger, l.Projected, l.Actual)
+		}
+	}
+	if strings.Contains(r.String(), "PROJECTED OVER") {
+		t.Errorf("Expected no projected overspend in a past month, got:\n%s", r)
+	}
+}
+
+func TestLoadBudgetsInvalid(t *testing.T) {
+	tests := []string{
+		`{"Office Expense": "-1.00"}`,
+		`{"Office Expense": "abc"}`,
+		`[]`,
+	}
+	for _, budgets := range tests {
+		if _, err := LoadBudgets(writeTemp(t, "budgets.json", budgets)); err == nil {
+			t.Errorf("Expected loading budgets %s to fail", budgets)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package restTest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Results of a cached request, as logged and counted in the cache metric.
+const (
+	// Served from the cache without a request, because it's fresh.
+	cacheHit = "hit"
+	// Served from the cache after the server responded 304 Not Modified.
+	cacheRevalidated = "revalidated"
+	// Fetched from the server.
+	cacheMiss = "miss"
+)
+
+// Cache is an http.RoundTripper that saves the 200 OK responses to GET
+// requests in Dir, with their ETag and Last-Modified headers. Later requests
+// for the same url are sent with If-None-Match and If-Modified-Since, so an
+// unchanged page costs a 304 Not Modified response with no body, and the
+// saved response is served instead.
+//
+// Responses served from the cache have an X-Cache header of hit, if no
+// request was made, or revalidated.
+type Cache struct {
+	// Directory the responses are saved in. It's created if it doesn't exist.
+	Dir string
+	// Transport used to make the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// How long a saved response is served without a request, to work offline
+	// or skip requests for pages that rarely change. 0 always revalidates.
+	MaxAge time.Duration
+	// Refresh ignores the saved responses and replaces them with new ones.
+	Refresh bool
+}
+
+// cachedResponse is the on-disk representation of a cached response.
+type cachedResponse struct {
+	recordedResponse
+	// When the response was saved or last revalidated.
+	Stored time.Time `json:"stored"`
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet {
+		return transport.RoundTrip(req)
+	}
+
+	path := recordingPath(c.Dir, req)
+	var cached *cachedResponse
+	if !c.Refresh {
+		cached = c.load(path, req)
+	}
+	if cached != nil && c.MaxAge > 0 && time.Since(cached.Stored) < c.MaxAge {
+		return c.serve(cached, req, cacheHit), nil
+	}
+
+	if cached != nil {
+		// Don't modify the caller's request
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		res.Body.Close()
+		// The server may have sent updated validators
+		if cached.Header == nil {
+			cached.Header = make(http.Header)
+		}
+		for _, h := range []string{"ETag", "Last-Modified", "Date"} {
+			if v := res.Header.Get(h); v != "" {
+				cached.Header.Set(h, v)
+			}
+		}
+		cached.Stored = time.Now()
+		c.save(path, cached)
+		return c.serve(cached, req, cacheRevalidated), nil
+	}
+
+	c.count(req, cacheMiss)
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+
+	rec, err := recordResponse(req, res)
+	if err != nil {
+		return nil, err
+	}
+	c.save(path, &cachedResponse{recordedResponse: rec, Stored: time.Now()})
+	return res, nil
+}
+
+// Returns the response saved for the request, or nil if there's none. A file
+// that can't be read, ex. because it was cut short, is treated as no response.
+func (c Cache) load(path string, req *http.Request) *cachedResponse {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cached := new(cachedResponse)
+	if err := json.Unmarshal(b, cached); err != nil {
+		Logger.Warn("ignoring unreadable cached response", "path", path, "err", err)
+		return nil
+	}
+	// Guard against hash collisions
+	if cached.Method != req.Method || cached.URL != req.URL.String() {
+		return nil
+	}
+	return cached
+}
+
+// Saves the response. Failing to is logged, since the request itself succeeded.
+func (c Cache) save(path string, cached *cachedResponse) {
+	b, err := json.Marshal(cached)
+	if err == nil {
+		err = os.MkdirAll(c.Dir, 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(path, func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		})
+	}
+	if err != nil {
+		Logger.Warn("couldn't save response to the cache", "url", cached.URL, "err", err)
+	}
+}
+
+// Returns the saved response, marked with how it was served.
+func (c Cache) serve(cached *cachedResponse, req *http.Request, result string) *http.Response {
+	c.count(req, result)
+	res := cached.response(req)
+	if res.Header == nil {
+		res.Header = make(http.Header)
+	}
+	res.Header.Set("X-Cache", result)
+	return res
+}
+
+// Counts and logs the request's result.
+func (c Cache) count(req *http.Request, result string) {
+	metrics.cache.add(result, 1)
+	Logger.Debug("cache "+result, "url", req.URL.String())
+}
@@ -0,0 +1,221 @@
+package restTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serves a page with a validator, and responds 304 Not Modified to requests
+// with the current one.
+type validatingHandler struct {
+	mutex sync.Mutex
+	// Version of the page. Changing it changes the body and validators.
+	version int
+	// Serve an ETag, or a Last-Modified date if false.
+	etag bool
+	// Serve weak ETags, which If-None-Match still matches strong ones with.
+	weak bool
+	// Conditional headers of the last request, and the number of requests.
+	ifNoneMatch, ifModifiedSince string
+	requests                     int
+}
+
+func (h *validatingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requests++
+	h.ifNoneMatch, h.ifModifiedSince = r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+
+	etag := fmt.Sprintf(`"v%d"`, h.version)
+	if h.weak {
+		etag = "W/" + etag
+	}
+	lastModified := time.Date(2013, 12, 1+h.version, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	if h.etag {
+		w.Header().Set("ETag", etag)
+		if strings.TrimPrefix(h.ifNoneMatch, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		w.Header().Set("Last-Modified", lastModified)
+		if h.ifModifiedSince == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	fmt.Fprintf(w, mockPageStr, 10*(h.version+1), 1)
+}
+
+// Gets the url through the cache and returns the page's total count and the
+// response's X-Cache header.
+func getCached(t *testing.T, c Cache, url string) (totalCount int, xCache string) {
+	t.Helper()
+	res, err := (&http.Client{Transport: c}).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var p Page
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	return p.TotalCount, res.Header.Get("X-Cache")
+}
+
+func TestCacheConditionalRequests(t *testing.T) {
+	for _, etag := range []bool{true, false} {
+		handler := &validatingHandler{etag: etag}
+		mockServer := httptest.NewServer(handler)
+		defer mockServer.Close()
+		url := pageURL(1, mockServer.URL+"/%d")
+		c := Cache{Dir: t.TempDir()}
+
+		tests := []struct {
+			name       string
+			version    int
+			totalCount int
+			xCache     string
+		}{
+			{"first request", 0, 10, ""},
+			{"unchanged", 0, 10, cacheRevalidated},
+			{"changed", 1, 20, ""},
+			{"unchanged after change", 1, 20, cacheRevalidated},
+		}
+		for _, test := range tests {
+			handler.mutex.Lock()
+			handler.version = test.version
+			handler.mutex.Unlock()
+
+			totalCount, xCache := getCached(t, c, url)
+			if totalCount != test.totalCount || xCache != test.xCache {
+				t.Errorf("ETag %t, %s: Expected total count %d and X-Cache %q, got %d and %q",
+					etag, test.name, test.totalCount, test.xCache, totalCount, xCache)
+			}
+		}
+
+		// The cached validator is sent back
+		handler.mutex.Lock()
+		if etag && handler.ifNoneMatch != `"v1"` {
+			t.Errorf("Expected If-None-Match %q, got %q", `"v1"`, handler.ifNoneMatch)
+		}
+		if expected := "Mon, 02 Dec 2013 00:00:00 GMT"; !etag && handler.ifModifiedSince != expected {
+			t.Errorf("Expected If-Modified-Since %q, got %q", expected, handler.ifModifiedSince)
+		}
+		handler.mutex.Unlock()
+		if files, _ := os.ReadDir(c.Dir); len(files) != 1 {
+			t.Errorf("Expected 1 cached response, got %d", len(files))
+		}
+	}
+}
+
+func TestCacheUpdatesValidators(t *testing.T) {
+	handler := &validatingHandler{etag: true}
+	mockServer := httptest.NewServer(handler)
+	defer mockServer.Close()
+	url := pageURL(1, mockServer.URL+"/%d")
+	c := Cache{Dir: t.TempDir()}
+
+	getCached(t, c, url)
+
+	// The server now answers with a weak ETag for the same page
+	handler.mutex.Lock()
+	handler.weak = true
+	handler.mutex.Unlock()
+	if totalCount, xCache := getCached(t, c, url); totalCount != 10 || xCache != cacheRevalidated {
+		t.Errorf("Expected the cached page with X-Cache %q, got total count %d and %q", cacheRevalidated, totalCount, xCache)
+	}
+
+	// The 304 response's ETag replaced the cached one
+	getCached(t, c, url)
+	handler.mutex.Lock()
+	if expected := `W/"v0"`; handler.ifNoneMatch != expected {
+		t.Errorf("Expected If-None-Match %q, got %q", expected, handler.ifNoneMatch)
+	}
+	handler.mutex.Unlock()
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	handler := &validatingHandler{etag: true}
+	mockServer := httptest.NewServer(handler)
+	url := pageURL(1, mockServer.URL+"/%d")
+	dir := t.TempDir()
+
+	getCached(t, Cache{Dir: dir}, url)
+
+	// An old enough response is revalidated
+	getCached(t, Cache{Dir: dir, MaxAge: time.Nanosecond}, url)
+	handler.mutex.Lock()
+	if handler.requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", handler.requests)
+	}
+	handler.mutex.Unlock()
+
+	// A fresh one is served offline
+	mockServer.Close()
+	if totalCount, xCache := getCached(t, Cache{Dir: dir, MaxAge: time.Hour}, url); totalCount != 10 || xCache != cacheHit {
+		t.Errorf("Expected the cached page with X-Cache %q, got total count %d and %q", cacheHit, totalCount, xCache)
+	}
+	if _, err := (&http.Client{Transport: Cache{Dir: dir}}).Get(url); err == nil {
+		t.Errorf("Expected revalidating without a server to fail")
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	handler := &validatingHandler{etag: true}
+	mockServer := httptest.NewServer(handler)
+	defer mockServer.Close()
+	url := pageURL(1, mockServer.URL+"/%d")
+	dir := t.TempDir()
+
+	getCached(t, Cache{Dir: dir}, url)
+	handler.mutex.Lock()
+	handler.version = 1
+	handler.mutex.Unlock()
+	if totalCount, xCache := getCached(t, Cache{Dir: dir, Refresh: true, MaxAge: time.Hour}, url); totalCount != 20 || xCache != "" {
+		t.Errorf("Expected the new page fetched, got total count %d and X-Cache %q", totalCount, xCache)
+	}
+	handler.mutex.Lock()
+	if handler.ifNoneMatch != "" {
+		t.Errorf("Expected no If-None-Match when refreshing, got %q", handler.ifNoneMatch)
+	}
+	handler.mutex.Unlock()
+
+	// The refreshed response replaced the cached one
+	if totalCount, _ := getCached(t, Cache{Dir: dir, MaxAge: time.Hour}, url); totalCount != 20 {
+		t.Errorf("Expected the refreshed page cached, got total count %d", totalCount)
+	}
+}
+
+func TestCacheSkipsErrorsAndOtherMethods(t *testing.T) {
+	handler := restTestHandler{http.StatusInternalServerError, 10, nil}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+	url := pageURL(1, mockServer.URL+"/%d")
+	client := &http.Client{Transport: Cache{Dir: t.TempDir(), MaxAge: time.Hour}}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req, _ := http.NewRequest(method, url, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: Expected status %d, got %d", method, http.StatusInternalServerError, res.StatusCode)
+		}
+	}
+	if files, _ := os.ReadDir(client.Transport.(Cache).Dir); len(files) != 0 {
+		t.Errorf("Expected no cached responses, got %d", len(files))
+	}
+}
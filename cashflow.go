@@ -0,0 +1,172 @@
+package restTest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+// CashFlowLine is a cash-flow statement line with the current period's amount
+// and the previous period's for comparison.
+type CashFlowLine struct {
+	Label    string
+	Current  money.Amount
+	Previous money.Amount
+}
+
+// Change returns the difference between the current and previous amounts.
+func (l CashFlowLine) Change() money.Amount {
+	return l.Current - l.Previous
+}
+
+// Returns the line's amounts and change (in percent of the previous
+// amount, if it's not 0) formatted as a table row.
+func (l CashFlowLine) String() string {
+	return l.format(40)
+}
+
+// Formats the line with its label padded to width.
+func (l CashFlowLine) format(width int) string {
+	percent := ""
+	if l.Previous != 0 {
+		percent = fmt.Sprintf("%+.1f%%", float64(l.Change())/float64(abs(l.Previous))*100)
+	}
+	return fmt.Sprintf("%-*s %12s %12s %12s %8s", width, l.Label, l.Current, l.Previous, l.Change(), percent)
+}
+
+// CashFlowStatement summarizes the money that came in and went out over a
+// period, compared with the period of the same length right before it.
+type CashFlowStatement struct {
+	// Inclusive date ranges of the current and previous periods.
+	From, To                 Date
+	PreviousFrom, PreviousTo Date
+
+	OpeningBalance CashFlowLine
+	// Sums of the positive and negative amounts.
+	Inflows  CashFlowLine
+	Outflows CashFlowLine
+	// Inflows plus outflows.
+	NetChange      CashFlowLine
+	ClosingBalance CashFlowLine
+
+	// Inflows and outflows of each ledger, largest current amount first.
+	InflowsByLedger  []CashFlowLine
+	OutflowsByLedger []CashFlowLine
+}
+
+// Returns the statement formatted as a table.
+func (s CashFlowStatement) String() string {
+	lines := []string{
+		fmt.Sprintf("Cash Flow %s to %s (previous period %s to %s)",
+			s.From.Format(dateTemplate), s.To.Format(dateTemplate),
+			s.PreviousFrom.Format(dateTemplate), s.PreviousTo.Format(dateTemplate)),
+		fmt.Sprintf("%-40s %12s %12s %12s %8s", "", "Current", "Previous", "Change", "%"),
+		s.OpeningBalance.String(),
+		s.Inflows.String(),
+	}
+	for _, l := range s.InflowsByLedger {
+		lines = append(lines, "  "+l.format(38))
+	}
+	lines = append(lines, s.Outflows.String())
+	for _, l := range s.OutflowsByLedger {
+		lines = append(lines, "  "+l.format(38))
+	}
+	lines = append(lines, s.NetChange.String(), s.ClosingBalance.String())
+	return strings.Join(lines, "\n")
+}
+
+// CashFlow returns the cash-flow statement of the transactions between from
+// and to, inclusive. The previous period is the one of the same number of
+// days ending the day before from. Balances include all transactions before
+// the period, so the opening balance is the running balance on the day
+// before from. Transactions with an empty ledger are grouped under
+// "Uncategorized".
+func CashFlow(ts []Transaction, from, to Date) CashFlowStatement {
+	days := int(to.Sub(from.Time).Hours()/24) + 1
+	s := CashFlowStatement{
+		From:         from,
+		To:           to,
+		PreviousFrom: Date{from.AddDate(0, 0, -days)},
+		PreviousTo:   Date{from.AddDate(0, 0, -1)},
+
+		OpeningBalance: CashFlowLine{Label: "Opening Balance"},
+		Inflows:        CashFlowLine{Label: "Inflows"},
+		Outflows:       CashFlowLine{Label: "Outflows"},
+		NetChange:      CashFlowLine{Label: "Net Change"},
+		ClosingBalance: CashFlowLine{Label: "Closing Balance"},
+	}
+
+	var (
+		inflows  = make(map[string]*CashFlowLine)
+		outflows = make(map[string]*CashFlowLine)
+	)
+	// Returns the ledger's line, adding it if it's missing
+	line := func(lines map[string]*CashFlowLine, ledger string) *CashFlowLine {
+		if ledger == "" {
+			ledger = uncategorized
+		}
+		l, ok := lines[ledger]
+		if !ok {
+			l = &CashFlowLine{Label: ledger}
+			lines[ledger] = l
+		}
+		return l
+	}
+
+	for _, t := range ts {
+		d := t.Date.Time
+		switch {
+		case d.Before(s.PreviousFrom.Time):
+			s.OpeningBalance.Previous += t.Amount
+			s.OpeningBalance.Current += t.Amount
+		case !d.After(s.PreviousTo.Time):
+			s.OpeningBalance.Current += t.Amount
+			if t.Amount > 0 {
+				s.Inflows.Previous += t.Amount
+				line(inflows, t.Ledger).Previous += t.Amount
+			} else {
+				s.Outflows.Previous += t.Amount
+				line(outflows, t.Ledger).Previous += t.Amount
+			}
+		case !d.After(to.Time):
+			if t.Amount > 0 {
+				s.Inflows.Current += t.Amount
+				line(inflows, t.Ledger).Current += t.Amount
+			} else {
+				s.Outflows.Current += t.Amount
+				line(outflows, t.Ledger).Current += t.Amount
+			}
+		}
+	}
+
+	s.NetChange.Current = s.Inflows.Current + s.Outflows.Current
+	s.NetChange.Previous = s.Inflows.Previous + s.Outflows.Previous
+	s.ClosingBalance.Current = s.OpeningBalance.Current + s.NetChange.Current
+	s.ClosingBalance.Previous = s.OpeningBalance.Previous + s.NetChange.Previous
+
+	s.InflowsByLedger = sortedLines(inflows)
+	s.OutflowsByLedger = sortedLines(outflows)
+	return s
+}
+
+// Returns the lines sorted by the magnitude of their current amount,
+// then their previous amount and label.
+func sortedLines(lines map[string]*CashFlowLine) []CashFlowLine {
+	sorted := make([]CashFlowLine, 0, len(lines))
+	for _, l := range lines {
+		sorted = append(sorted, *l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if abs(a.Current) != abs(b.Current) {
+			return abs(a.Current) > abs(b.Current)
+		}
+		if abs(a.Previous) != abs(b.Previous) {
+			return abs(a.Previous) > abs(b.Previous)
+		}
+		return a.Label < b.Label
+	})
+	return sorted
+}
@@ -0,0 +1,63 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestCashFlow(t *testing.T) {
+	ts := []Transaction{
+		// Before the previous period
+		{newDate("2013-10-15"), "", 100000, "DEPOSIT"},
+		// Previous period
+		{newDate("2013-11-05"), "Consulting Income", 200000, "CLIENT A"},
+		{newDate("2013-11-20"), "Office Expense", -4253, "FEDEX"},
+		// Current period
+		{newDate("2013-12-01"), "Consulting Income", 300000, "CLIENT A"},
+		{newDate("2013-12-13"), "Equipment Expense", -551817, "APPLE STORE"},
+		{newDate("2013-12-30"), "Office Expense", -3069, "DHL"},
+		{newDate("2013-12-31"), "", 1000, "REFUND"},
+		// After
+		{newDate("2014-01-01"), "Office Expense", -100, "FEDEX"},
+	}
+
+	s := CashFlow(ts, newDate("2013-12-01"), newDate("2013-12-31"))
+
+	if from, to := s.PreviousFrom.Format(dateTemplate), s.PreviousTo.Format(dateTemplate); from != "2013-10-31" || to != "2013-11-30" {
+		t.Errorf("Expected previous period 2013-10-31 to 2013-11-30, got %s to %s", from, to)
+	}
+
+	tests := []struct {
+		line     CashFlowLine
+		current  money.Amount
+		previous money.Amount
+	}{
+		{s.OpeningBalance, 295747, 100000},
+		{s.Inflows, 301000, 200000},
+		{s.Outflows, -554886, -4253},
+		{s.NetChange, -253886, 195747},
+		{s.ClosingBalance, 41861, 295747},
+	}
+	for _, tc := range tests {
+		if tc.line.Current != tc.current || tc.line.Previous != tc.previous {
+			t.Errorf("Expected %s %s (previous %s), got %s (previous %s)",
+				tc.line.Label, tc.current, tc.previous, tc.line.Current, tc.line.Previous)
+		}
+	}
+
+	if len(s.OutflowsByLedger) != 2 || s.OutflowsByLedger[0].Label != "Equipment Expense" {
+		t.Fatalf("Expected Equipment then Office outflows, got %v", s.OutflowsByLedger)
+	}
+	if office := s.OutflowsByLedger[1]; office.Current != -3069 || office.Previous != -4253 {
+		t.Errorf("Expected office outflows -30.69 (previous -42.53), got %s (previous %s)", office.Current, office.Previous)
+	}
+	if len(s.InflowsByLedger) != 2 || s.InflowsByLedger[1].Label != uncategorized {
+		t.Errorf("Expected Consulting Income then Uncategorized inflows, got %v", s.InflowsByLedger)
+	}
+
+	if report := s.String(); !strings.Contains(report, "Inflows                                       3010.00      2000.00      1010.00   +50.5%") {
+		t.Errorf("Expected inflows line with comparison, got:\n%s", report)
+	}
+}
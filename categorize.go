@@ -0,0 +1,171 @@
+package restTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+// CategoryRule sets the ledger of the transactions that meet all of its
+// conditions. Conditions left empty always hold.
+type CategoryRule struct {
+	// Label shown in dry runs. Defaults to "rule N", N being its position.
+	Name string `json:"name"`
+	// Regular expressions matched against the company and the current ledger.
+	// Use "^$" as the ledger to only categorize transactions without one.
+	Company string `json:"company"`
+	Ledger  string `json:"ledger"`
+	// Inclusive range of the signed amount. Ex. "-100.00" to "0".
+	MinAmount *money.Amount `json:"minAmount"`
+	MaxAmount *money.Amount `json:"maxAmount"`
+	// Inclusive date range.
+	From *Date `json:"from"`
+	To   *Date `json:"to"`
+	// Ledger assigned to matching transactions.
+	Set string `json:"set"`
+
+	company, ledger *regexp.Regexp
+}
+
+// Reports whether the transaction meets all of the rule's conditions.
+func (r CategoryRule) matches(t Transaction) bool {
+	switch {
+	case r.company != nil && !r.company.MatchString(t.Company):
+	case r.ledger != nil && !r.ledger.MatchString(t.Ledger):
+	case r.MinAmount != nil && t.Amount < *r.MinAmount:
+	case r.MaxAmount != nil && t.Amount > *r.MaxAmount:
+	case r.From != nil && t.Date.Before(r.From.Time):
+	case r.To != nil && t.Date.After(r.To.Time):
+	default:
+		return true
+	}
+	return false
+}
+
+// Categorizer assigns ledgers to transactions using an ordered list of
+// rules. The first rule a transaction matches sets its ledger.
+type Categorizer struct {
+	rules []CategoryRule
+}
+
+// Categorization is the outcome of categorizing a transaction.
+type Categorization struct {
+	// The transaction with its new ledger.
+	Transaction Transaction
+	// Ledger it had before.
+	Previous string
+	// Rule that matched it. nil if no rule did.
+	Rule *CategoryRule
+}
+
+// NewCategorizer returns a categorizer that evaluates the rules in order.
+func NewCategorizer(rules []CategoryRule) (*Categorizer, error) {
+	c := &Categorizer{rules: make([]CategoryRule, len(rules))}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		var err error
+		if r.Company != "" {
+			if r.company, err = regexp.Compile(r.Company); err != nil {
+				return nil, fmt.Errorf("%s: %v", r.Name, err)
+			}
+		}
+		if r.Ledger != "" {
+			if r.ledger, err = regexp.Compile(r.Ledger); err != nil {
+				return nil, fmt.Errorf("%s: %v", r.Name, err)
+			}
+		}
+		if r.Set == "" {
+			return nil, fmt.Errorf("%s: missing the ledger to set", r.Name)
+		}
+
+		c.rules[i] = r
+	}
+	return c, nil
+}
+
+// LoadCategorizer reads the rules from a JSON file holding an array of
+// CategoryRule objects. YAML files are rejected with an error saying so. Ex.
+//
+//	[{"name": "hosting", "company": "GROWINGCITY", "set": "Web Hosting & Services Expense"},
+//	 {"ledger": "^$", "maxAmount": "0", "set": "Uncategorized Expense"}]
+func LoadCategorizer(path string) (*Categorizer, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return nil, fmt.Errorf("%s: category rules must be a JSON file, YAML isn't supported", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []CategoryRule
+	if err = json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	c, err := NewCategorizer(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Categorize returns the outcome of categorizing each transaction, in order.
+// Transactions no rule matched keep their ledger.
+func (c *Categorizer) Categorize(ts []Transaction) []Categorization {
+	cs := make([]Categorization, len(ts))
+	for i, t := range ts {
+		cs[i] = Categorization{Transaction: t, Previous: t.Ledger}
+		for j := range c.rules {
+			if r := &c.rules[j]; r.matches(t) {
+				cs[i].Transaction.Ledger = r.Set
+				cs[i].Rule = r
+				break
+			}
+		}
+	}
+	return cs
+}
+
+// Apply returns a copy of the transactions with their ledgers set by the rules.
+func (c *Categorizer) Apply(ts []Transaction) []Transaction {
+	out := make([]Transaction, len(ts))
+	for i, cat := range c.Categorize(ts) {
+		out[i] = cat.Transaction
+	}
+	return out
+}
+
+// Returns the categorization formatted as date, amount, company, the ledger
+// change and the rule that made it.
+func (c Categorization) String() string {
+	t := c.Transaction
+	rule := "no rule matched"
+	if c.Rule != nil {
+		rule = c.Rule.Name
+	}
+	return fmt.Sprintf("%s\t%12s\t%-40s\t%q -> %q\t(%s)",
+		t.Date.Format(dateTemplate), t.Amount, t.Company, c.Previous, t.Ledger, rule)
+}
+
+// DryRun returns a report of which rule matched each transaction,
+// followed by the transactions no rule matched.
+func (c *Categorizer) DryRun(ts []Transaction) string {
+	var matched, unmatched []string
+	for _, cat := range c.Categorize(ts) {
+		if cat.Rule == nil {
+			unmatched = append(unmatched, cat.String())
+		} else {
+			matched = append(matched, cat.String())
+		}
+	}
+
+	return fmt.Sprintf("Matched (%d):\n%s\n-----------\nUnmatched (%d):\n%s",
+		len(matched), strings.Join(matched, "\n"), len(unmatched), strings.Join(unmatched, "\n"))
+}
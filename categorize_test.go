@@ -0,0 +1,90 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+)
+
+const categoryRules = `[
+	{"name": "hosting", "company": "GROWINGCITY", "set": "Web Hosting & Services Expense"},
+	{"name": "big equipment", "ledger": "^Equipment", "maxAmount": "-1000", "set": "Capital Equipment"},
+	{"name": "december refunds", "minAmount": 0, "from": "2013-12-01", "to": "2013-12-31", "set": "Refunds"},
+	{"ledger": "^$", "set": "Uncategorized Expense"}
+]`
+
+func TestCategorize(t *testing.T) {
+	c, err := LoadCategorizer(writeTemp(t, "rules.json", categoryRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := []Transaction{
+		{newDate("2013-12-12"), "", -6301, "GROWINGCITY.COM xxxxxx4926 BC"},
+		{newDate("2013-12-13"), "Equipment Expense", -551817, "APPLE STORE #R280 VANCOUVER BC"},
+		{newDate("2013-12-13"), "Equipment Expense", -52085, "ECHOSIGN xxxxxxxx6744"},
+		{newDate("2013-12-20"), "Office Expense", 4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		{newDate("2014-01-20"), "Office Expense", 4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		{newDate("2014-01-21"), "", -100, "UNKNOWN"},
+	}
+	expected := []struct {
+		ledger string
+		rule   string
+	}{
+		{"Web Hosting & Services Expense", "hosting"},
+		{"Capital Equipment", "big equipment"},
+		{"Equipment Expense", ""},
+		{"Refunds", "december refunds"},
+		{"Office Expense", ""},
+		{"Uncategorized Expense", "rule 4"},
+	}
+
+	cs := c.Categorize(ts)
+	for i, e := range expected {
+		cat := cs[i]
+		if cat.Transaction.Ledger != e.ledger {
+			t.Errorf("Expected transaction %d ledger %q, got %q", i, e.ledger, cat.Transaction.Ledger)
+		}
+		if e.rule == "" && cat.Rule != nil {
+			t.Errorf("Expected transaction %d to match no rule, got %s", i, cat.Rule.Name)
+		} else if e.rule != "" && (cat.Rule == nil || cat.Rule.Name != e.rule) {
+			t.Errorf("Expected transaction %d to match %s, got %v", i, e.rule, cat.Rule)
+		}
+		if cat.Previous != ts[i].Ledger {
+			t.Errorf("Expected previous ledger %q, got %q", ts[i].Ledger, cat.Previous)
+		}
+	}
+
+	// Apply leaves the input untouched
+	applied := c.Apply(ts)
+	if applied[0].Ledger != "Web Hosting & Services Expense" || ts[0].Ledger != "" {
+		t.Errorf("Expected Apply to categorize a copy, got %q and original %q", applied[0].Ledger, ts[0].Ledger)
+	}
+
+	report := c.DryRun(ts)
+	if !strings.HasPrefix(report, "Matched (4):") || !strings.Contains(report, "Unmatched (2):") {
+		t.Errorf("Expected dry run to report 4 matched and 2 unmatched, got:\n%s", report)
+	}
+}
+
+func TestNewCategorizerInvalid(t *testing.T) {
+	tests := []string{
+		`[{"company": "(", "set": "X"}]`,
+		`[{"ledger": "(", "set": "X"}]`,
+		`[{"company": "FEDEX"}]`,
+		`[{"from": "2013-13-01", "set": "X"}]`,
+		`{}`,
+	}
+
+	for _, rules := range tests {
+		if _, err := LoadCategorizer(writeTemp(t, "rules.json", rules)); err == nil {
+			t.Errorf("Expected loading rules %s to fail", rules)
+		}
+	}
+
+	for _, name := range []string{"rules.yaml", "rules.YML"} {
+		_, err := LoadCategorizer(writeTemp(t, name, "- set: Office Expense\n"))
+		if err == nil || !strings.Contains(err.Error(), "YAML isn't supported") {
+			t.Errorf("Expected loading %s to fail with a YAML error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package restTest
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mujz/restTest/money"
+)
+
+// DefaultChartHeight is the number of rows of a running balance chart.
+const DefaultChartHeight = 12
+
+// Braille patterns are 2 dots wide and 4 dots high. brailleDots holds the
+// bit of each dot, indexed by row then column, to add to brailleBase.
+const brailleBase = '⠀'
+
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// Block characters of a sparkline, from lowest to highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Chart returns a line chart of the running balances drawn with braille
+// characters, at most width columns wide and height rows high. The y axis is
+// labeled with the highest and lowest balances and the x axis with the first
+// and last days. Days are spaced evenly whatever the gaps between them.
+func (db DailyBalances) Chart(width, height int) string {
+	if len(db.days) == 0 {
+		return ""
+	}
+	if height < 2 {
+		height = 2
+	}
+
+	values := make([]money.Amount, len(db.days))
+	for i, day := range db.days {
+		values[i] = db.balances[day]
+	}
+	lo, hi := minMax(values)
+
+	var (
+		loLabel, hiLabel = lo.String(), hi.String()
+		labelWidth       = max(len(loLabel), len(hiLabel))
+		// The label, a space and the axis precede the plot
+		cols = max(width-labelWidth-2, 1)
+	)
+
+	// Plot the values on a grid of dots, joining each point to the previous
+	// one with a vertical line so that steep changes stay connected.
+	var (
+		dotsWide, dotsHigh = cols * 2, height * 4
+		grid               = make([][]rune, height)
+		prevY              = -1
+	)
+	for i := range grid {
+		grid[i] = make([]rune, cols)
+		for j := range grid[i] {
+			grid[i][j] = brailleBase
+		}
+	}
+	for x := 0; x < dotsWide; x++ {
+		v := values[resample(x, dotsWide, len(values))]
+		y := dotsHigh / 2
+		if hi != lo {
+			y = (dotsHigh - 1) - int(int64(v-lo)*int64(dotsHigh-1)/int64(hi-lo))
+		}
+		from, to := y, y
+		if prevY >= 0 {
+			from, to = min(y, prevY), max(y, prevY)
+		}
+		for dy := from; dy <= to; dy++ {
+			grid[dy/4][x/2] += brailleDots[dy%4][x%2]
+		}
+		prevY = y
+	}
+
+	s := make([]string, 0, height+2)
+	for i, row := range grid {
+		label := ""
+		switch i {
+		case 0:
+			label = hiLabel
+		case height - 1:
+			label = loLabel
+		}
+		axis := "│"
+		if label != "" {
+			axis = "┤"
+		}
+		s = append(s, fmt.Sprintf("%*s %s%s", labelWidth, label, axis, string(row)))
+	}
+	s = append(s, fmt.Sprintf("%*s └%s", labelWidth, "", strings.Repeat("─", cols)))
+
+	first, last := db.days[0].Format(dateTemplate), db.days[len(db.days)-1].Format(dateTemplate)
+	dates := first
+	if gap := cols + 1 - len(first) - len(last); len(db.days) > 1 && gap > 0 {
+		dates += strings.Repeat(" ", gap) + last
+	}
+	s = append(s, fmt.Sprintf("%*s %s", labelWidth, "", dates))
+
+	return strings.Join(s, "\n")
+}
+
+// Sparkline returns the values as a line of block characters, one per value.
+// If there are more values than width, they're sampled evenly.
+func Sparkline(values []money.Amount, width int) string {
+	if len(values) == 0 || width < 1 {
+		return ""
+	}
+	n := min(len(values), width)
+	lo, hi := minMax(values)
+
+	s := make([]rune, n)
+	for i := range s {
+		v := values[resample(i, n, len(values))]
+		level := len(sparkBlocks) / 2
+		if hi != lo {
+			level = int(int64(v-lo) * int64(len(sparkBlocks)-1) / int64(hi-lo))
+		}
+		s[i] = sparkBlocks[level]
+	}
+	return string(s)
+}
+
+// Sparklines returns a line per ledger with its total and a sparkline of
+// its running daily balances, fitting in width columns.
+func (lb LedgerBalances) Sparklines(width int) string {
+	const format = "%-40s %12s "
+	// Width of the ledger and total columns
+	prefix := utf8.RuneCountInString(fmt.Sprintf(format, "", ""))
+
+	var s []string
+	for _, l := range lb.ledgers {
+		b := lb.balances[l]
+		values := make([]money.Amount, len(b.Daily.days))
+		for i, day := range b.Daily.days {
+			values[i] = b.Daily.balances[day]
+		}
+		s = append(s, fmt.Sprintf(format, b.Ledger, b.Total)+Sparkline(values, width-prefix))
+	}
+	return strings.Join(s, "\n")
+}
+
+// Returns the index of the i-th of n samples taken evenly from length values.
+func resample(i, n, length int) int {
+	if n <= 1 {
+		return length - 1
+	}
+	return i * (length - 1) / (n - 1)
+}
+
+// Returns the lowest and highest values.
+func minMax(values []money.Amount) (lo, hi money.Amount) {
+	lo, hi = values[0], values[0]
+	for _, v := range values[1:] {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	return lo, hi
+}
@@ -0,0 +1,85 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestChart(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-01"), "", 100000, "DEPOSIT"},
+		{newDate("2013-12-05"), "Office Expense", -25000, "FEDEX"},
+		{newDate("2013-12-10"), "Office Expense", -50000, "FEDEX"},
+	}
+	db := DailyBalancesFromTransactions(Slice(ts))
+
+	chart := db.Chart(40, 5)
+	lines := strings.Split(chart, "\n")
+	if len(lines) != 7 {
+		t.Fatalf("Expected 5 rows, the x axis and the dates, got:\n%s", chart)
+	}
+	for _, l := range lines {
+		if n := utf8.RuneCountInString(l); n > 40 {
+			t.Errorf("Expected lines at most 40 columns wide, got %d: %q", n, l)
+		}
+	}
+	if !strings.HasPrefix(lines[0], "1000.00 ┤") || !strings.HasPrefix(lines[4], " 250.00 ┤") {
+		t.Errorf("Expected max and min labels on the first and last rows, got:\n%s", chart)
+	}
+	if !strings.HasPrefix(lines[1], "        │") {
+		t.Errorf("Expected an unlabeled y axis between them, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[5], "        └─") {
+		t.Errorf("Expected an x axis, got %q", lines[5])
+	}
+	if d := strings.Fields(lines[6]); len(d) != 2 || d[0] != "2013-12-01" || d[1] != "2013-12-10" {
+		t.Errorf("Expected first and last dates under the x axis, got %q", lines[6])
+	}
+	// The line starts at the top left and ends at the bottom right
+	if r, _ := utf8.DecodeLastRuneInString(lines[4]); r == brailleBase {
+		t.Errorf("Expected the last balance on the bottom row, got %q", lines[4])
+	}
+	if r, _ := utf8.DecodeRuneInString(strings.TrimPrefix(lines[0], "1000.00 ┤")); r == brailleBase {
+		t.Errorf("Expected the first balance on the top row, got %q", lines[0])
+	}
+
+	if c := (DailyBalances{}).Chart(40, 5); c != "" {
+		t.Errorf("Expected no chart without balances, got %q", c)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values   []money.Amount
+		width    int
+		expected string
+	}{
+		{[]money.Amount{0, 100, 200, 300, 400, 500, 600, 700}, 10, "▁▂▃▄▅▆▇█"},
+		{[]money.Amount{-700, 0, -700}, 10, "▁█▁"},
+		{[]money.Amount{0, 100, 200, 300, 400, 500, 600, 700}, 2, "▁█"},
+		{[]money.Amount{5, 5}, 10, "▅▅"},
+		{nil, 10, ""},
+	}
+	for _, tc := range tests {
+		if s := Sparkline(tc.values, tc.width); s != tc.expected {
+			t.Errorf("Expected sparkline of %v %q, got %q", tc.values, tc.expected, s)
+		}
+	}
+}
+
+func TestLedgerSparklines(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-01"), "Office Expense", -1000, "FEDEX"},
+		{newDate("2013-12-02"), "Office Expense", -1000, "FEDEX"},
+		{newDate("2013-12-01"), "", 5000, "DEPOSIT"},
+	}
+	s := LedgerBalancesFromTransactions(Slice(ts)).Sparklines(80)
+	expected := "Office Expense                                 -20.00 █▁\n" +
+		"Uncategorized                                   50.00 ▅"
+	if s != expected {
+		t.Errorf("Expected sparklines:\n%s\nGot:\n%s", expected, s)
+	}
+}
@@ -0,0 +1,287 @@
+package restTest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Identifies checkpoint files and their format version.
+const checkpointMagic = "restTest checkpoint v1\n"
+
+// Checkpoint saves the transactions of each fetched page to a file, along
+// with a bitmap of the pages fetched, so that fetching all pages can resume
+// where it stopped if it's interrupted. The file consists of:
+//
+//	the magic line                 restTest checkpoint v1\n
+//	the header length and header   uint32, JSON of the url template, total count and number of pages
+//	the completion bitmap          a bit per page, set once the page is saved
+//	the page records               uint32 page number, uint32 length, JSON of the page's transactions
+//
+// Page records are appended as pages are fetched, in any order, and a page's
+// bit is set after its record is written. A record whose bit isn't set was
+// interrupted and is ignored, and if a page has more than one record, the
+// last one is used.
+type Checkpoint struct {
+	path   string
+	header checkpointHeader
+
+	mutex        sync.Mutex
+	file         *os.File
+	bitmapOffset int64
+	bitmap       []byte
+	// Offset the next page record is written at
+	end int64
+	// Transactions of the pages saved before the checkpoint was opened
+	pages map[int][]Transaction
+}
+
+// What a checkpoint was saved for.
+type checkpointHeader struct {
+	URLTemplate string `json:"urlTemplate"`
+	TotalCount  int    `json:"totalCount"`
+	Pages       int    `json:"pages"`
+}
+
+// OpenCheckpoint opens the checkpoint at path to fetch pages from the url
+// template, which has totalCount transactions, or creates it if it doesn't
+// exist. Returns CheckpointError if the checkpoint was saved for another url
+// template or total count.
+func OpenCheckpoint(path, urlTemplate string, totalCount int) (*Checkpoint, error) {
+	header := checkpointHeader{urlTemplate, totalCount, numPages(totalCount)}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := createCheckpoint(path, header); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{path: path, file: f, pages: make(map[int][]Transaction)}
+	if err := c.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if c.header.URLTemplate != urlTemplate || c.header.TotalCount != totalCount {
+		f.Close()
+		return nil, CheckpointError{path, urlTemplate, c.header.URLTemplate, totalCount, c.header.TotalCount}
+	}
+	return c, nil
+}
+
+// Writes a checkpoint with no pages saved, with writeFileAtomic.
+func createCheckpoint(path string, header checkpointHeader) error {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(checkpointMagic)
+	binary.Write(&b, binary.BigEndian, uint32(len(h)))
+	b.Write(h)
+	b.Write(make([]byte, bitmapSize(header.Pages)))
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(b.Bytes())
+		return err
+	})
+}
+
+// Writes a file at path with write. It's written to a temporary file that's
+// renamed to path, so an interrupted write leaves the previous file intact.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Reads the header, the bitmap and the saved pages. A page record cut short
+// by an interruption ends the file; it's truncated so new records follow the
+// last complete one.
+func (c *Checkpoint) load() error {
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(c.file, magic); err != nil || string(magic) != checkpointMagic {
+		return errors.New("not a checkpoint file")
+	}
+	var n uint32
+	if err := binary.Read(c.file, binary.BigEndian, &n); err != nil {
+		return err
+	}
+	h := make([]byte, n)
+	if _, err := io.ReadFull(c.file, h); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(h, &c.header); err != nil {
+		return fmt.Errorf("invalid checkpoint header: %w", err)
+	}
+
+	c.bitmapOffset = int64(len(magic)) + 4 + int64(n)
+	c.bitmap = make([]byte, bitmapSize(c.header.Pages))
+	if _, err := io.ReadFull(c.file, c.bitmap); err != nil {
+		return err
+	}
+	c.end = c.bitmapOffset + int64(len(c.bitmap))
+
+	info, err := c.file.Stat()
+	if err != nil {
+		return err
+	}
+	for {
+		page, ts, n, err := readPageRecord(c.file, info.Size()-c.end)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return c.file.Truncate(c.end)
+		}
+		c.end += n
+		if c.done(page) {
+			c.pages[page] = ts
+		}
+	}
+}
+
+// Reads a page record from the remaining bytes of the file. Returns the
+// record's length, or io.EOF if there are no more records. A record longer
+// than the remaining bytes is cut short, and returns io.ErrUnexpectedEOF.
+func readPageRecord(r io.Reader, remaining int64) (page int, ts []Transaction, n int64, err error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, nil, 0, err
+	}
+	page = int(binary.BigEndian.Uint32(prefix[:4]))
+	size := int64(binary.BigEndian.Uint32(prefix[4:]))
+	if size > remaining-int64(len(prefix)) {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	if err := json.Unmarshal(b, &ts); err != nil {
+		return 0, nil, 0, err
+	}
+	return page, ts, int64(len(prefix) + len(b)), nil
+}
+
+// Returns the number of pages holding totalCount transactions. There's
+// always at least one page.
+func numPages(totalCount int) int {
+	if totalCount < 1 {
+		return 1
+	}
+	return (totalCount-1)/transactionsPerPage + 1
+}
+
+// Returns the number of bytes in the bitmap of n pages.
+func bitmapSize(pages int) int {
+	return (pages + 7) / 8
+}
+
+// Path returns the checkpoint's file path.
+func (c *Checkpoint) Path() string {
+	return c.path
+}
+
+// Done reports whether the page is saved.
+func (c *Checkpoint) Done(page int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.done(page)
+}
+
+func (c *Checkpoint) done(page int) bool {
+	i := page - 1
+	if i < 0 || i/8 >= len(c.bitmap) {
+		return false
+	}
+	return c.bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// Completed returns the number of pages saved.
+func (c *Checkpoint) Completed() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n := 0
+	for page := 1; page <= c.header.Pages; page++ {
+		if c.done(page) {
+			n++
+		}
+	}
+	return n
+}
+
+// Transactions returns the transactions of a page saved before the checkpoint
+// was opened, and whether there is one.
+func (c *Checkpoint) Transactions(page int) ([]Transaction, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ts, ok := c.pages[page]
+	return ts, ok
+}
+
+// Save appends the page's transactions to the checkpoint and marks the page
+// as done. The file isn't synced, so a saved page survives the process being
+// killed but not necessarily the machine crashing.
+func (c *Checkpoint) Save(page int, ts []Transaction) error {
+	if page < 1 || page > c.header.Pages {
+		return fmt.Errorf("checkpoint %s has no page %d", c.path, page)
+	}
+	if ts == nil {
+		ts = []Transaction{}
+	}
+	b, err := json.Marshal(ts)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint32(record[:4], uint32(page))
+	binary.BigEndian.PutUint32(record[4:], uint32(len(b)))
+	record = append(record, b...)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := c.file.WriteAt(record, c.end); err != nil {
+		return err
+	}
+	c.end += int64(len(record))
+
+	i := page - 1
+	c.bitmap[i/8] |= 1 << (i % 8)
+	_, err = c.file.WriteAt(c.bitmap[i/8:i/8+1], c.bitmapOffset+int64(i/8))
+	return err
+}
+
+// Close closes the checkpoint's file, keeping it to resume from.
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// Remove closes and deletes the checkpoint's file.
+func (c *Checkpoint) Remove() error {
+	c.file.Close()
+	return os.Remove(c.path)
+}
@@ -0,0 +1,237 @@
+package restTest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.ckpt")
+	template := "http://localhost/%d.json"
+
+	c, err := OpenCheckpoint(path, template, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []int{1, 3} {
+		if err := c.Save(page, mockPage.Transactions[:page]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Save(6, nil); err == nil {
+		t.Errorf("Expected an error saving page 6 of 5")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved pages are read back when it's reopened
+	c, err = OpenCheckpoint(path, template, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for page := 1; page <= 5; page++ {
+		done := page == 1 || page == 3
+		if c.Done(page) != done {
+			t.Errorf("Expected page %d done to be %t, got %t", page, done, !done)
+		}
+		ts, ok := c.Transactions(page)
+		if ok != done {
+			t.Errorf("Expected page %d saved to be %t, got %t", page, done, ok)
+		} else if done && !reflect.DeepEqual(ts, mockPage.Transactions[:page]) {
+			t.Errorf("Expected page %d transactions %v, got %v", page, mockPage.Transactions[:page], ts)
+		}
+	}
+	if n := c.Completed(); n != 2 {
+		t.Errorf("Expected 2 pages completed, got %d", n)
+	}
+	c.Close()
+
+	// A checkpoint of another total count or url template can't be resumed
+	tests := []struct {
+		template   string
+		totalCount int
+	}{
+		{template, 40},
+		{"http://example.com/%d.json", 45},
+	}
+	for _, test := range tests {
+		_, err := OpenCheckpoint(path, test.template, test.totalCount)
+		var cpErr CheckpointError
+		if !errors.As(err, &cpErr) {
+			t.Errorf("Expected CheckpointError, got %v", err)
+		} else if cpErr.SavedTotalCount != 45 || cpErr.SavedURLTemplate != template {
+			t.Errorf("Expected the saved total count 45 and url template %s, got %+v", template, cpErr)
+		}
+	}
+
+	// Other files aren't checkpoints
+	other := writeTemp(t, "other.json", `{"totalCount": 45}`)
+	if _, err := OpenCheckpoint(other, template, 45); err == nil || !strings.Contains(err.Error(), "not a checkpoint file") {
+		t.Errorf("Expected a not a checkpoint file error, got %v", err)
+	}
+}
+
+func TestCheckpointInterruptedSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.ckpt")
+	template := "http://localhost/%d.json"
+
+	c, err := OpenCheckpoint(path, template, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Save(1, mockPage.Transactions)
+	// Page 2's record is written, but its bit isn't set
+	c.Save(2, mockPage.Transactions)
+	c.file.WriteAt([]byte{1}, c.bitmapOffset)
+	c.Close()
+
+	// Page 3's record is cut short
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 3, 0, 0, 1, 0, '['})
+	f.Close()
+
+	c, err = OpenCheckpoint(path, template, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Transactions(2); ok {
+		t.Errorf("Expected page 2 without its bit set to be ignored")
+	}
+	if _, ok := c.Transactions(3); ok {
+		t.Errorf("Expected page 3's partial record to be ignored")
+	}
+	// New records follow the last complete one
+	if err := c.Save(3, mockPage.Transactions[:2]); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	c, err = OpenCheckpoint(path, template, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ts, ok := c.Transactions(3); !ok || len(ts) != 2 {
+		t.Errorf("Expected page 3 with 2 transactions, got %v", ts)
+	}
+	if n := c.Completed(); n != 2 {
+		t.Errorf("Expected 2 pages completed, got %d", n)
+	}
+
+	// A corrupt length longer than the rest of the file is a cut short record
+	record := []byte{0, 0, 0, 4, 0xff, 0xff, 0xff, 0xff, '['}
+	if _, _, _, err := readPageRecord(bytes.NewReader(record), int64(len(record))); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestAPISourceCheckpoint(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		requests []string
+		// Page that responds with a 500 Internal Server Error
+		failing = "/4"
+	)
+	handler := restTestHandler{status: http.StatusOK, totalCount: 45}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.URL.Path)
+		fail := r.URL.Path == failing
+		mutex.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer mockServer.Close()
+
+	path := filepath.Join(t.TempDir(), "pages.ckpt")
+	template := mockServer.URL + "/%d"
+
+	// The fetch fails at page 4, leaving pages 1 to 3 in the checkpoint
+	src := &API{URLTemplate: template, Concurrency: 1, Checkpoint: path}
+	for range src.Transactions() {
+	}
+	if src.Err() == nil {
+		t.Fatal("Expected the fetch to fail")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the checkpoint to be kept, got %v", err)
+	}
+
+	// Resuming only fetches the first page and the missing ones
+	mutex.Lock()
+	requests, failing = nil, ""
+	mutex.Unlock()
+	all := readAll(t, &API{URLTemplate: template, Concurrency: 1, Checkpoint: path})
+	if n := len(all); n != 50 {
+		t.Errorf("Expected %d transactions, got %d", 50, n)
+	}
+	if expected := []string{"/1", "/4", "/5"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected requests %v, got %v", expected, requests)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed once all pages are fetched, got %v", err)
+	}
+
+	// The total count changed since the checkpoint was saved
+	c, err := OpenCheckpoint(path, template, 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	src = &API{URLTemplate: template, Checkpoint: path}
+	for range src.Transactions() {
+	}
+	var cpErr CheckpointError
+	if !errors.As(src.Err(), &cpErr) || cpErr.TotalCount != 45 || cpErr.SavedTotalCount != 35 {
+		t.Errorf("Expected CheckpointError from 35 to 45 transactions, got %v", src.Err())
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	write := func(s string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(path, write("first")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected a file with mode 0644, got %v, %v", info, err)
+	}
+
+	// A failed write leaves the previous file and no temporary file
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		write("second")(w)
+		return errors.New("interrupted")
+	})
+	if err == nil || err.Error() != "interrupted" {
+		t.Errorf("Expected error interrupted, got %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "first" {
+		t.Errorf("Expected the previous file %q, got %q", "first", b)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(files))
+	}
+}
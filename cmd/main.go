@@ -1,29 +1,705 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mujz/restTest"
+	"github.com/mujz/restTest/money"
 )
 
 var (
-	concurrency = flag.Int("concurrency", restTest.DefaultConcurrency, "Number of concurrent go routines that fetch pages")
+	concurrency       = flag.Int("concurrency", restTest.DefaultConcurrency, "Number of concurrent go routines that fetch pages")
+	record            = flag.String("record", "", "Directory to save every fetched page response to")
+	replay            = flag.String("replay", "", "Directory to serve previously recorded page responses from instead of the API server")
+	cacheDir          = flag.String("cache-dir", "", "Directory to cache page responses in, to only download the pages that changed since the last run. Ex. ~/.cache/restTest")
+	cacheMaxAge       = flag.Duration("cache-max-age", 0, "How long -cache-dir pages are used without asking the server whether they changed, ex. to work offline. Ex. 24h")
+	refresh           = flag.Bool("refresh", false, "Fetch every page again, replacing the -cache-dir responses")
+	noCache           = flag.Bool("no-cache", false, "Don't use the -cache-dir responses for this run, ex. when -cache-dir is set in an alias")
+	checkpoint        = flag.String("checkpoint", "", "File to save fetched pages to, so a fetch that's interrupted resumes from where it stopped when run again")
+	source            = flag.String("source", "api", "Where to read transactions from: api, pages:DIR, json:FILE, ndjson (stdin), csv:FILE, ofx:FILE, qif:FILE, bankcsv:FILE or db:FILE")
+	export            = flag.String("export", "", "Print the transactions as a ledger, hledger or beancount journal, or an ofx, qif or csv file instead of the daily balances")
+	account           = flag.String("account", "Assets:Bank", "Asset account on the other side of exported transactions")
+	currency          = flag.String("currency", "CAD", "Currency of exported transactions")
+	by                = flag.String("by", "", "Print a breakdown report instead of the daily balances: ledger or company")
+	merchantRules     = flag.String("merchant-rules", "", "JSON file of rules that rename companies for -by company, -recurring and -forecast")
+	top               = flag.Int("top", 10, "Number of merchants in the -by company report. 0 for all")
+	recurring         = flag.Bool("recurring", false, "Print the recurring transactions (ex. subscriptions) instead of the daily balances")
+	anomalies         = flag.Bool("anomalies", false, "Print unusual days and transactions instead of the daily balances")
+	anomalyWindow     = flag.Int("anomaly-window", restTest.DefaultAnomalyWindow, "Number of previous days or ledger transactions -anomalies compares each value with")
+	anomalyMethod     = flag.String("anomaly-method", "mad", "Statistic -anomalies scores values with: mad (modified z-score) or zscore")
+	anomalyThreshold  = flag.Float64("anomaly-threshold", restTest.DefaultAnomalyThreshold, "Score above which -anomalies flags a value")
+	failOnAnomalies   = flag.Bool("fail-on-anomalies", false, "Exit with status 1 if -anomalies flags anything")
+	forecast          = flag.Int("forecast", 0, "Number of days to project the running balance after the last transaction")
+	forecastThreshold = flag.String("forecast-threshold", "", "Report the first date -forecast projects the balance below this amount. Ex. 500.00")
+	cashflow          = flag.Bool("cashflow", false, "Print the cash-flow statement from -from to -to, compared with the period before it")
+	from              = flag.String("from", "", "First day of the -cashflow period or of the query command's transactions. Ex. 2013-12-01. Defaults to the first transaction's date")
+	to                = flag.String("to", "", "Last day of the -cashflow period or of the query command's transactions. Ex. 2013-12-31. Defaults to the last transaction's date")
+	report            = flag.String("report", "", "Write a self-contained HTML report of the balances, ledgers and top merchants to this file")
+	chart             = flag.Bool("chart", false, "Print a chart of the running balance and sparklines of each ledger instead of the daily balances")
+	budgets           = flag.String("budgets", "", "JSON file of monthly budgets per ledger to compare with the spend of -month. Ex. {\"Office Expense\": \"500.00\"}")
+	month             = flag.String("month", "", "Month of the -budgets report. Ex. 2013-12. Defaults to the last transaction's month")
+	failOnBudget      = flag.Bool("fail-on-budget", false, "Exit with status 1 if -budgets finds a budget exceeded")
+	categoryRules     = flag.String("category-rules", "", "JSON file of rules that set transaction ledgers, applied before any report or export. YAML isn't supported")
+	dryRun            = flag.Bool("dry-run", false, "Print which -category-rules rule matched each transaction, and the ones none matched, then exit")
+	ofxLedgers        = flag.String("ofx-ledgers", "", "Ledgers of the -source ofx:FILE transactions by OFX transaction type. Ex. DEBIT=Expenses,INT=Interest,*=Other")
+	csvMapping        = flag.String("csv-mapping", "", "JSON file describing the columns of the bank CSV export read by -source bankcsv:FILE")
+	logLevel          = flag.String("log-level", "warn", "Lowest level of the messages logged to stderr: debug, info, warn or error")
+	logFormat         = flag.String("log-format", "text", "Format of the messages logged to stderr: text or json")
+	progress          = flag.Bool("progress", true, "Show a progress bar on stderr while fetching pages. Only shown when stderr is a terminal, and not by the serve command")
+	trace             = flag.String("trace", "", "Write timing spans of the run, page fetches and aggregation phases to this file as JSON lines")
+	metricsAddr       = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics while running. Ex. :9100")
+	addr              = flag.String("addr", ":8080", "Address the serve command listens on")
+	db                = flag.String("db", "", "Store file the sync command keeps the synced transactions in, and the query command reads them from")
+	ledger            = flag.String("ledger", "", "Ledger of the query command's transactions")
+	company           = flag.String("company", "", "Company of the query command's transactions")
+	groupBy           = flag.String("group-by", "", "Print the totals of the query command's transactions by ledger, company, day or month")
+	sample            = flag.Int("sample", restTest.DefaultSyncSample, "Number of earlier pages the sync command refetches to detect changed transactions")
+	refreshInterval   = flag.Duration("refresh-interval", 0, "How often the serve command reloads the transactions. Ex. 15m. 0 to only reload on POST /refresh")
 )
 
 func main() {
 	flag.Parse()
+	// Commands come before their flags. Ex. restTest serve -addr :8080
+	command := flag.Arg(0)
+	if command != "" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
 	restTest.Concurrency = *concurrency
 
-	// Get transactions from restTest API server
-	ch := restTest.FetchAllTransactions()
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	restTest.Logger = logger
 
-	// Calculate running daily balances from fetched transactions
-	dailyBalances := restTest.DailyBalancesFromTransactions(ch)
+	// The server's refreshes would draw bars between its log lines
+	if _, tty := terminalSize(os.Stderr); *progress && tty && command != "serve" {
+		restTest.Progress = showProgress
+	}
+
+	if *trace != "" {
+		startTrace(*trace)
+		defer endTrace(nil)
+	}
+
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr)
+	}
+
+	useCache := *cacheDir != "" && !*noCache
+	switch {
+	case *record != "" && *replay != "":
+		fatalf("-record and -replay can't be used together")
+	case *cacheDir == "" && (*cacheMaxAge != 0 || *refresh):
+		fatalf("-cache-max-age and -refresh require -cache-dir")
+	case *noCache && (*cacheMaxAge != 0 || *refresh):
+		fatalf("-no-cache can't be used with -cache-max-age or -refresh")
+	case useCache && (*record != "" || *replay != ""):
+		fatalf("-cache-dir can't be used with -record or -replay")
+	case *record != "":
+		if err := os.MkdirAll(*record, 0755); err != nil {
+			fatalf("%v", err)
+		}
+		restTest.Client = &http.Client{Transport: restTest.Recorder{Dir: *record}}
+	case *replay != "":
+		restTest.Client = &http.Client{Transport: restTest.Replayer{Dir: *replay}}
+	case useCache:
+		restTest.Client = &http.Client{Transport: restTest.Cache{Dir: *cacheDir, MaxAge: *cacheMaxAge, Refresh: *refresh}}
+	}
+
+	switch command {
+	case "":
+	case "serve":
+		serve()
+		return
+	case "sync":
+		syncStore()
+		return
+	case "query":
+		query()
+		return
+	default:
+		fatalf("unknown command %q", command)
+	}
+
+	src, transactions, err := readTransactions(runSpan)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if *dryRun {
+		if *categoryRules == "" {
+			fatalf("-dry-run requires -category-rules")
+		}
+		c, err := restTest.LoadCategorizer(*categoryRules)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Println(c.DryRun(transactions))
+		return
+	}
+	if transactions, err = categorize(transactions); err != nil {
+		fatalf("%v", err)
+	}
+
+	if *export != "" {
+		if err := exportTransactions(*export, transactions); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+
+	if *recurring {
+		n, err := normalizer()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Recurring Transactions:\n%s\n", restTest.DetectRecurring(transactions, n, restTest.Date{}))
+		return
+	}
+
+	if *anomalies {
+		var method restTest.AnomalyMethod
+		switch *anomalyMethod {
+		case "mad":
+			method = restTest.MAD
+		case "zscore":
+			method = restTest.ZScore
+		default:
+			fatalf("unknown -anomaly-method %q", *anomalyMethod)
+		}
+		as := restTest.DetectAnomalies(transactions, restTest.AnomalyOptions{
+			Window:    *anomalyWindow,
+			Threshold: *anomalyThreshold,
+			Method:    method,
+		})
+		fmt.Printf("Anomalies (%d):\n%s\n", len(as), as)
+		if len(as) > 0 && *failOnAnomalies {
+			exit(1)
+		}
+		return
+	}
+
+	if *forecast > 0 {
+		n, err := normalizer()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		f := restTest.ForecastBalances(transactions, restTest.ForecastOptions{Days: *forecast, Normalizer: n})
+		fmt.Printf("Running Daily Balances (* projected):\n%s\n", f)
+
+		if *forecastThreshold != "" {
+			threshold, err := money.Parse(*forecastThreshold)
+			if err != nil {
+				fatalf("invalid -forecast-threshold: %v", err)
+			}
+			fmt.Println("-----------")
+			if d, ok := f.BelowThreshold(threshold); ok {
+				fmt.Printf("Projected below %s on: \t%s\n", threshold, d.Format("2006-01-02"))
+			} else {
+				fmt.Printf("Not projected below %s\n", threshold)
+			}
+		}
+		return
+	}
+
+	if *cashflow {
+		start, end, err := period(transactions)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Println(restTest.CashFlow(transactions, start, end))
+		return
+	}
+
+	if *report != "" {
+		n, err := normalizer()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		f, err := os.Create(*report)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		err = restTest.WriteHTMLReport(f, transactions, restTest.ReportOptions{Source: *source, Normalizer: n, TopMerchants: *top})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fatalf("%s: %v", *report, err)
+		}
+		return
+	}
+
+	if *chart {
+		width := terminalWidth(os.Stdout)
+		dailyBalances := restTest.DailyBalancesFromTransactions(restTest.Slice(transactions))
+		fmt.Printf("Running Balance:\n%s\n\n", dailyBalances.Chart(width, restTest.DefaultChartHeight))
+		fmt.Printf("Ledgers:\n%s\n", restTest.LedgerBalancesFromTransactions(restTest.Slice(transactions)).Sparklines(width))
+		return
+	}
+
+	if *budgets != "" {
+		b, err := restTest.LoadBudgets(*budgets)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		var m restTest.Date
+		if *month != "" {
+			if m, err = restTest.ParseMonth(*month); err != nil {
+				fatalf("invalid -month: %v", err)
+			}
+		} else {
+			for _, t := range transactions {
+				if t.Date.After(m.Time) {
+					m = t.Date
+				}
+			}
+		}
+		r := restTest.CompareBudgets(transactions, b, m, restTest.Date{})
+		fmt.Println(r)
+		over := r.Exceeded()
+		for _, l := range over {
+			fmt.Fprintf(os.Stderr, "restTest: warning: %s budget %s exceeded by %s\n", l.Ledger, l.Budget, -l.Variance)
+		}
+		if len(over) > 0 && *failOnBudget {
+			exit(1)
+		}
+		return
+	}
+
+	switch *by {
+	case "":
+	case "ledger":
+		fmt.Printf("Ledger Balances:\n%s\n", restTest.LedgerBalancesFromTransactions(restTest.Slice(transactions)))
+		return
+	case "company":
+		n, err := normalizer()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Top Merchants:\n%s\n", restTest.TopMerchants(transactions, n, *top))
+		return
+	default:
+		fatalf("unknown -by report %q", *by)
+	}
+
+	// Calculate running daily balances from the source's transactions
+	dailyBalances := restTest.DailyBalancesIn(runSpan, restTest.Slice(transactions))
 
 	// Print running daily balances
 	fmt.Printf("Running Daily Balances:\n%s\n-----------\n", dailyBalances)
 
 	// Print overall balance
 	fmt.Printf("Total Balance: \t%v\n", dailyBalances.GetRunningBalance())
+
+	// Reconcile against the balance the bank reports
+	if ofx, ok := src.(*restTest.OFXFile); ok {
+		s := ofx.Statement
+		fmt.Printf("Bank Ledger Balance: \t%v (as of %s)\n", s.LedgerBalance, s.LedgerBalanceDate.Format("2006-01-02"))
+		fmt.Printf("Difference: \t%v\n", s.Reconcile(dailyBalances))
+	}
+}
+
+// Reads the transactions from -source, in spans that are children of span.
+// If the -checkpoint can't be resumed, it asks whether to discard it and
+// start over.
+func readTransactions(span restTest.Span) (restTest.Source, []restTest.Transaction, error) {
+	src, err := newSource(*source, span)
+	if err != nil {
+		return nil, nil, err
+	}
+	transactions, err := restTest.ReadAll(src)
+
+	var cpErr restTest.CheckpointError
+	if errors.As(err, &cpErr) {
+		if !confirm(fmt.Sprintf("%v. Discard it and fetch all pages again?", cpErr)) {
+			return nil, nil, fmt.Errorf("%v. Delete it to fetch all pages again", cpErr)
+		}
+		if err := os.Remove(cpErr.Path); err != nil {
+			return nil, nil, err
+		}
+		return readTransactions(span)
+	}
+	return src, transactions, err
+}
+
+// Asks the question on stderr and reports whether the answer is yes. It's
+// no without asking if stdin isn't a terminal.
+func confirm(question string) bool {
+	if _, tty := terminalSize(os.Stdin); !tty {
+		return false
+	}
+	if progressLine {
+		fmt.Fprintln(os.Stderr)
+		progressLine = false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// Sets the transactions' ledgers with -category-rules, if given.
+func categorize(transactions []restTest.Transaction) ([]restTest.Transaction, error) {
+	if *categoryRules == "" {
+		return transactions, nil
+	}
+	c, err := restTest.LoadCategorizer(*categoryRules)
+	if err != nil {
+		return nil, err
+	}
+	return c.Apply(transactions), nil
+}
+
+// Reads the transactions from -source and categorizes them.
+func load(span restTest.Span) ([]restTest.Transaction, error) {
+	_, transactions, err := readTransactions(span)
+	if err != nil {
+		return nil, err
+	}
+	return categorize(transactions)
+}
+
+// Serves the transactions as a JSON API on -addr until interrupted, then
+// waits for the requests in progress to finish.
+func serve() {
+	s := &restTest.Server{Load: load, Span: runSpan}
+	if err := s.Refresh(); err != nil {
+		fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *refreshInterval > 0 {
+		go s.RefreshEvery(ctx, *refreshInterval, func(err error) {
+			restTest.Logger.Error("refresh failed", "err", err)
+		})
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: s}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	restTest.Logger.Info("serving", "addr", *addr)
+
+	select {
+	case err := <-errs:
+		fatalf("%v", err)
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		fatalf("shutdown: %v", err)
+	}
+}
+
+// Syncs the -db store with the API, fetching only the pages that could have
+// changed, and prints the daily balances.
+func syncStore() {
+	if *db == "" {
+		fatalf("sync requires -db")
+	}
+	if *source != "api" {
+		fatalf("sync requires -source api")
+	}
+	s, err := restTest.LoadSyncStore(*db)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	result, err := s.Sync("", restTest.SyncOptions{Sample: *sample, Span: runSpan})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := s.Save(*db); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "restTest: synced %d transactions: %s\n", s.TotalCount, result)
+
+	dailyBalances := s.DailyBalances()
+	fmt.Printf("Running Daily Balances:\n%s\n-----------\n", dailyBalances)
+	if s.TotalCount > 0 {
+		fmt.Printf("Total Balance: \t%v\n", dailyBalances.GetRunningBalance())
+	}
+}
+
+// Prints the transactions in the -db store, or from -source if there's no
+// store, that match -from, -to, -ledger and -company, or their totals
+// grouped by -group-by.
+func query() {
+	var (
+		s   *restTest.Store
+		err error
+	)
+	if *db != "" {
+		s, err = restTest.LoadStore(*db)
+	} else {
+		var transactions []restTest.Transaction
+		if transactions, err = load(runSpan); err == nil {
+			s = restTest.NewStore(transactions)
+		}
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	q := restTest.Query{Ledger: *ledger, Company: *company}
+	if *from != "" {
+		if q.From, err = restTest.ParseDate(*from); err != nil {
+			fatalf("invalid -from: %v", err)
+		}
+	}
+	if *to != "" {
+		if q.To, err = restTest.ParseDate(*to); err != nil {
+			fatalf("invalid -to: %v", err)
+		}
+	}
+
+	if *groupBy != "" {
+		groups, err := s.GroupBy(q, *groupBy)
+		if err != nil {
+			fatalf("invalid -group-by: %v", err)
+		}
+		fmt.Println(groups)
+		return
+	}
+	for _, t := range s.Find(q) {
+		fmt.Printf("%s  %-40s %12s  %s\n", t.Date.Format("2006-01-02"), t.Ledger, t.Amount, t.Company)
+	}
+	a := s.Sum(q)
+	fmt.Printf("-----------\nTotal: \t%v (%d transactions)\n", a.Total, a.Count)
+}
+
+// Returns a logger writing to stderr, so logs don't mix with the data on stdout.
+func newLogger(level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid -log-format %q: must be text or json", format)
+}
+
+var (
+	// When the progress bar was last drawn, and whether it's
+	// drawn on the last line of stderr.
+	progressDrawn time.Time
+	progressLine  bool
+)
+
+// Draws the progress bar over the previous one, at most every 100ms.
+func showProgress(p restTest.FetchProgress) {
+	if !p.Done() && time.Since(progressDrawn) < 100*time.Millisecond {
+		return
+	}
+	progressDrawn = time.Now()
+	// Return to the start of the line and clear it after the bar
+	fmt.Fprintf(os.Stderr, "\r%s\x1b[K", restTest.ProgressBar(p, terminalWidth(os.Stderr)-1))
+	progressLine = !p.Done()
+	if p.Done() {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+var (
+	// File spans are written to with -trace, and the run's span.
+	traceFile *os.File
+	runSpan   restTest.Span
+)
+
+// Writes spans to the file, with a run span as the root.
+func startTrace(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	traceFile = f
+	restTest.Tracing = restTest.NewJSONTracer(f)
+	attrs := []slog.Attr{slog.String("source", *source)}
+	if command := flag.Arg(0); command != "" {
+		attrs = append(attrs, slog.String("command", command))
+	}
+	runSpan = restTest.StartRun("run", attrs...)
+}
+
+// Ends the run span with err and closes the trace file.
+func endTrace(err error) {
+	if runSpan == nil {
+		return
+	}
+	runSpan.End(err)
+	runSpan = nil
+	if cerr := traceFile.Close(); cerr != nil {
+		fmt.Fprintf(os.Stderr, "restTest: -trace: %v\n", cerr)
+	} else if terr := restTest.Tracing.(*restTest.JSONTracer).Err(); terr != nil {
+		fmt.Fprintf(os.Stderr, "restTest: -trace: %v\n", terr)
+	}
+}
+
+// Serves the metrics on addr at /metrics. Exits if it can't listen.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", restTest.MetricsHandler())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fatalf("-metrics-addr: %v", err)
+	}
+}
+
+// Returns the transaction source described by spec, which is
+// the source kind optionally followed by a colon and a path.
+// API fetches are traced as children of span.
+func newSource(spec string, span restTest.Span) (restTest.Source, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	if *checkpoint != "" && kind != "api" {
+		return nil, fmt.Errorf("-checkpoint requires -source api")
+	}
+
+	switch kind {
+	case "api":
+		return &restTest.API{Checkpoint: *checkpoint, Span: span}, nil
+	case "ndjson":
+		return &restTest.NDJSON{Reader: os.Stdin}, nil
+	case "pages", "json", "csv", "ofx", "qfx", "qif", "bankcsv", "db":
+		if path == "" {
+			return nil, fmt.Errorf("-source %s requires a path. Ex. %s:transactions", kind, kind)
+		}
+	default:
+		return nil, fmt.Errorf("unknown -source %q", kind)
+	}
+
+	switch kind {
+	case "pages":
+		return &restTest.PageDir{Dir: path}, nil
+	case "json":
+		return &restTest.JSONFile{Path: path}, nil
+	case "ofx", "qfx":
+		o := &restTest.OFXFile{Path: path}
+		if *ofxLedgers != "" {
+			ledgers, err := restTest.ParseLedgerTypes(*ofxLedgers)
+			if err != nil {
+				return nil, fmt.Errorf("-ofx-ledgers: %v", err)
+			}
+			o.Ledger = restTest.LedgerByType(ledgers)
+		}
+		return o, nil
+	case "qif":
+		return &restTest.QIFFile{Path: path}, nil
+	case "db":
+		return &restTest.StoreFile{Path: path}, nil
+	case "bankcsv":
+		if *csvMapping == "" {
+			return nil, fmt.Errorf("-source bankcsv requires -csv-mapping")
+		}
+		m, err := restTest.LoadCSVMapping(*csvMapping)
+		if err != nil {
+			return nil, err
+		}
+		return &restTest.BankCSVFile{Path: path, Mapping: m}, nil
+	}
+	return &restTest.CSVFile{Path: path}, nil
+}
+
+// Returns the merchant normalizer with the -merchant-rules rules, if any.
+func normalizer() (*restTest.Normalizer, error) {
+	if *merchantRules == "" {
+		return nil, nil
+	}
+	return restTest.LoadNormalizer(*merchantRules)
+}
+
+// Returns the period set by -from and -to, defaulting to the
+// dates of the first and last transactions.
+func period(transactions []restTest.Transaction) (start, end restTest.Date, err error) {
+	for _, t := range transactions {
+		if start.IsZero() || t.Date.Before(start.Time) {
+			start = t.Date
+		}
+		if t.Date.After(end.Time) {
+			end = t.Date
+		}
+	}
+
+	if *from != "" {
+		if start, err = restTest.ParseDate(*from); err != nil {
+			return start, end, fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+	if *to != "" {
+		if end, err = restTest.ParseDate(*to); err != nil {
+			return start, end, fmt.Errorf("invalid -to: %v", err)
+		}
+	}
+	if end.Before(start.Time) {
+		return start, end, fmt.Errorf("-to must not be before -from")
+	}
+	return start, end, nil
+}
+
+// Returns the width to draw at on f: its terminal's, else $COLUMNS, else 80.
+func terminalWidth(f *os.File) int {
+	if w, _ := terminalSize(f); w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
+
+// Writes the transactions to stdout in the plain-text accounting or bank format.
+func exportTransactions(format string, transactions []restTest.Transaction) error {
+	opts := restTest.JournalOptions{Account: *account, Currency: *currency}
+	switch format {
+	case "ledger", "hledger":
+		return restTest.WriteLedger(os.Stdout, transactions, opts)
+	case "beancount":
+		return restTest.WriteBeancount(os.Stdout, transactions, opts)
+	case "ofx":
+		return restTest.WriteOFX(os.Stdout, transactions, restTest.OFXOptions{Currency: *currency})
+	case "qif":
+		return restTest.WriteQIF(os.Stdout, transactions)
+	case "csv":
+		return restTest.WriteCSV(os.Stdout, transactions)
+	}
+	return fmt.Errorf("unknown -export format %q", format)
+}
+
+// Prints the error message to stderr and exits with status 2.
+func fatalf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	endTrace(errors.New(msg))
+	if progressLine {
+		fmt.Fprintln(os.Stderr)
+	}
+	fmt.Fprintln(os.Stderr, "restTest: "+msg)
+	os.Exit(2)
+}
+
+// Exits with the status after ending the trace.
+func exit(status int) {
+	endTrace(nil)
+	os.Exit(status)
 }
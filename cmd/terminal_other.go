@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import "os"
+
+// Terminal sizes are only queried on Linux and macOS. Elsewhere, character
+// devices are assumed to be terminals that don't report their size.
+func terminalSize(f *os.File) (cols int, ok bool) {
+	fi, err := f.Stat()
+	return 0, err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -2,8 +2,10 @@ package restTest
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mujz/restTest/money"
 )
@@ -51,8 +53,11 @@ func (db *DailyBalances) setRunningDailyBalances() {
 	}
 }
 
-// GetRunningBalance returns the last day's balance.
+// GetRunningBalance returns the last day's balance, or 0 if there are no days.
 func (db DailyBalances) GetRunningBalance() money.Amount {
+	if len(db.days) == 0 {
+		return 0
+	}
 	return db.balances[db.days[len(db.days)-1]]
 }
 
@@ -62,17 +67,30 @@ func (db *DailyBalances) Sort() {
 	byDate(db.days).Sort()
 }
 
-// DailyBalancesFromTransactions receives transaction slices over the channel, sorts them, and calculates
-// their running daily balances. It returns after the channel is closed.
+// DailyBalancesFromTransactions receives transaction slices from the source, sorts them, and calculates
+// their running daily balances. It returns after the source's channel is closed. Check the source's Err
+// to know whether it read all transactions. Wrap a plain channel with Channel to pass it as a source.
 //
 // Blocks until it finishes processing all transactions.
-func DailyBalancesFromTransactions(ch chan []Transaction) DailyBalances {
+func DailyBalancesFromTransactions(src Source) DailyBalances {
+	return DailyBalancesIn(nil, src)
+}
+
+// DailyBalancesIn is DailyBalancesFromTransactions with its spans started as
+// children of parent, ex. a run's span. parent may be nil.
+func DailyBalancesIn(parent Span, src Source) DailyBalances {
 	var (
 		wg    sync.WaitGroup
 		mutex = &sync.Mutex{}
 
 		db = DailyBalances{balances: make(map[Date]money.Amount)}
+		ch = src.Transactions()
+
+		span       = startSpan("daily balances", parent)
+		accumulate = startSpan("accumulate", span)
+		count      atomic.Int64
 	)
+	defer span.End(nil)
 
 	// Waits for transaction slices to come then launches a go routine for each
 	// to loop over each transaction and add it to the daily balance.
@@ -99,17 +117,31 @@ func DailyBalancesFromTransactions(ch chan []Transaction) DailyBalances {
 
 				mutex.Unlock()
 			}
+			metrics.transactions.add("", float64(len(ts)))
+			count.Add(int64(len(ts)))
 		}(ts)
 	}
 
 	// Wait until all transactions have been processed
 	wg.Wait()
+	accumulate.SetAttributes(slog.Int64("transactions", count.Load()), slog.Int("days", len(db.days)))
+	accumulate.End(nil)
 
 	// Sort days slice
+	sorting := startSpan("sort", span)
 	db.Sort()
+	sorting.End(nil)
 
 	// Calculate running daily balances
+	runningSum := startSpan("running sum", span)
 	db.setRunningDailyBalances()
+	runningSum.End(nil)
+
+	if len(db.days) > 0 {
+		metrics.totalBalance.set(float64(db.GetRunningBalance()) / 100)
+		Logger.Debug("calculated daily balances", "days", len(db.days), "from", db.days[0].Format(dateTemplate),
+			"to", db.days[len(db.days)-1].Format(dateTemplate), "total", db.GetRunningBalance())
+	}
 
 	return db
 }
@@ -84,6 +84,14 @@ func TestDailyBalancesGetRunningBalance(t *testing.T) {
 	}
 }
 
+func TestDailyBalancesGetRunningBalanceEmpty(t *testing.T) {
+	db := DailyBalancesFromTransactions(Slice(nil))
+
+	if actual := db.GetRunningBalance(); actual != 0 {
+		t.Errorf("Expected running balance: 0.00, Got:%.2f", actual)
+	}
+}
+
 func TestDailyBalancesSort(t *testing.T) {
 	d0 := newDate("2016-04-03")
 	d1 := newDate("2016-04-01")
@@ -167,7 +175,7 @@ func TestDailyBalancesFromTransactions(t *testing.T) {
 			close(ch)
 		}(ch)
 
-		actual := DailyBalancesFromTransactions(ch)
+		actual := DailyBalancesFromTransactions(Channel(ch))
 
 		if actual.String() != tc.expected.String() {
 			t.Errorf("Expected daily balances:\n%v\n---\nGot:\n%v", tc.expected, actual)
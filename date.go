@@ -9,7 +9,7 @@ import (
 const dateTemplate = "2006-01-02"
 
 // Date is a representation of time.Time using layout "2006-01-02".
-// Implements json.Unmarshaler.
+// Implements json.Marshaler and json.Unmarshaler.
 type Date struct{ time.Time }
 
 // Implements sort.Interface to enable sorting a date slice.
@@ -33,6 +33,17 @@ func (date *Date) UnmarshalJSON(b []byte) (err error) {
 	if s == "null" {
 		return nil
 	}
-	date.Time, err = time.Parse(dateTemplate, s)
+	*date, err = ParseDate(s)
 	return
 }
+
+// MarshalJSON marshals date into a string in layout 2006-01-02.
+func (date Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + date.Format(dateTemplate) + `"`), nil
+}
+
+// ParseDate parses a date string in layout 2006-01-02.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateTemplate, s)
+	return Date{t}, err
+}
@@ -38,6 +38,16 @@ func TestDateUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestDateMarshalJSON(t *testing.T) {
+	b, err := newDate("2013-12-22").MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `"2013-12-22"` {
+		t.Errorf("Expected date \"2013-12-22\", Got %s", s)
+	}
+}
+
 func TestByDateSort(t *testing.T) {
 	ts := []struct {
 		input    []string
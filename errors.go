@@ -14,3 +14,37 @@ type HTTPError struct {
 func (err HTTPError) Error() string {
 	return fmt.Sprintf("Remote server responded with status: %s", err.Status)
 }
+
+// ReplayError is returned when replaying recorded responses and a request
+// doesn't match any of them.
+type ReplayError struct {
+	// Request method. Ex. GET.
+	Method string
+	// Request URL.
+	URL string
+}
+
+// Implements error.
+func (err ReplayError) Error() string {
+	return fmt.Sprintf("No recorded response for request: %s %s", err.Method, err.URL)
+}
+
+// CheckpointError is returned when resuming from a checkpoint that was saved
+// while fetching from another url template, or when the total count was
+// different. Its pages can't be trusted to line up with the API's.
+type CheckpointError struct {
+	// Checkpoint file path.
+	Path string
+	// Url template being fetched, and the one the checkpoint was saved for.
+	URLTemplate, SavedURLTemplate string
+	// Current total count, and the one the checkpoint was saved for.
+	TotalCount, SavedTotalCount int
+}
+
+// Implements error.
+func (err CheckpointError) Error() string {
+	if err.URLTemplate != err.SavedURLTemplate {
+		return fmt.Sprintf("Checkpoint %s was saved while fetching %s, not %s", err.Path, err.SavedURLTemplate, err.URLTemplate)
+	}
+	return fmt.Sprintf("Checkpoint %s was saved when the total count was %d, but it's now %d", err.Path, err.SavedTotalCount, err.TotalCount)
+}
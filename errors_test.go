@@ -9,3 +9,32 @@ func TestHTTPError(t *testing.T) {
 		t.Errorf("Expected error %s, Got %s", expected, actual)
 	}
 }
+
+func TestReplayError(t *testing.T) {
+	err := ReplayError{"GET", "http://localhost/1.json"}
+	expected := "No recorded response for request: GET http://localhost/1.json"
+	if actual := err.Error(); actual != expected {
+		t.Errorf("Expected error %s, Got %s", expected, actual)
+	}
+}
+
+func TestCheckpointError(t *testing.T) {
+	tests := []struct {
+		err      CheckpointError
+		expected string
+	}{
+		{
+			CheckpointError{"pages.ckpt", "http://localhost/%d.json", "http://localhost/%d.json", 40, 38},
+			"Checkpoint pages.ckpt was saved when the total count was 38, but it's now 40",
+		},
+		{
+			CheckpointError{"pages.ckpt", "http://localhost/%d.json", "http://example.com/%d.json", 40, 40},
+			"Checkpoint pages.ckpt was saved while fetching http://example.com/%d.json, not http://localhost/%d.json",
+		},
+	}
+	for _, test := range tests {
+		if actual := test.err.Error(); actual != test.expected {
+			t.Errorf("Expected error %s, Got %s", test.expected, actual)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package restTest
 import (
 	"encoding/json"
 	"fmt"
-	"math"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -22,6 +25,12 @@ const (
 var (
 	// Concurrency is the number of concurrent go routines that fetch pages.
 	Concurrency = DefaultConcurrency
+	// Client is the HTTP client used to fetch pages. Set its Transport to a
+	// Recorder or Replayer to save or serve page responses from disk.
+	Client = &http.Client{}
+	// Logger logs page requests, data validation warnings and summaries.
+	// It discards everything by default.
+	Logger = slog.New(slog.DiscardHandler)
 )
 
 // Page represents a slice of transactions.
@@ -59,23 +68,56 @@ func pageURL(n int, urlTemplate string) string {
 // Calls HTTP GET to the passed url and decodes the response body into Page struct.
 // returns HTTPError if response status is not 200
 func fetchPage(url string) (*Page, error) {
-	res, err := http.Get(url)
+	page, _, err := fetchPageIn(nil, url)
+	return page, err
+}
+
+// Fetches the page in a span that's a child of parent. Returns the number
+// of bytes read from the response body.
+func fetchPageIn(parent Span, url string) (page *Page, n int64, err error) {
+	span := startSpan("fetch page", parent)
+	span.SetAttributes(slog.String("url", url))
+	defer func() { span.End(err) }()
+
+	start := time.Now()
+	page, status, n, err := getPage(url)
+	attrs := []any{"url", url, "status", status, "duration", time.Since(start), "bytes", n}
+	span.SetAttributes(slog.Int("status", status), slog.Int64("bytes", n))
+
 	if err != nil {
-		return nil, err
+		metrics.fetchErrors.add("", 1)
+		Logger.Error("page request failed", append(attrs, "err", err)...)
+		return nil, n, err
+	}
+	metrics.pagesFetched.add("", 1)
+	Logger.Debug("fetched page", attrs...)
+	return page, n, nil
+}
+
+// Fetches and decodes the page. Returns the response status code, or 0 if
+// there's no response, and the number of body bytes read.
+func getPage(url string) (page *Page, status int, n int64, err error) {
+	defer metrics.latency.since(time.Now())
+
+	res, err := Client.Get(url)
+	if err != nil {
+		return nil, 0, 0, err
 	}
 	defer res.Body.Close()
+	metrics.responses.add(strconv.Itoa(res.StatusCode), 1)
 
 	if res.StatusCode != http.StatusOK {
-		return nil, HTTPError{res.Status, res.StatusCode}
+		return nil, res.StatusCode, 0, HTTPError{res.Status, res.StatusCode}
 	}
 
-	page := new(Page)
-	err = json.NewDecoder(res.Body).Decode(page)
+	body := &countingReader{Reader: res.Body}
+	page = new(Page)
+	err = json.NewDecoder(body).Decode(page)
 	if err != nil {
-		return nil, err
+		return nil, res.StatusCode, body.n, err
 	}
 
-	return page, nil
+	return page, res.StatusCode, body.n, nil
 }
 
 // FetchAllTransactions fetches all pages from the restTest API and
@@ -90,75 +132,218 @@ func FetchAllTransactions() chan []Transaction {
 	return ch
 }
 
+// Fetches all pages and closes the channel once all transactions are
+// put in it. Panics if fetching any of the pages fails.
+func fetchAllTransactions(ch chan []Transaction, urlTemplate string, concurrency int) {
+	if err := fetchAll(nil, ch, urlTemplate, concurrency, ""); err != nil {
+		panic(err)
+	}
+	close(ch)
+}
+
 // Fetches the first page to get total number of pages to fetch.
-// Then launches a go routine to fetch each page. After the last
-// transaction is put in the channel, it closes the channel.
+// Then launches a go routine to fetch each page and returns after the
+// last transaction is put in the channel. It doesn't close the channel.
 //
-// It only launches as many go routines as the passed concurrency flag
-func fetchAllTransactions(ch chan []Transaction, urlTemplate string, concurrency int) {
+// It only launches as many go routines as the passed concurrency flag.
+// If fetching a page fails, it stops launching go routines, waits for
+// the running ones to finish and returns the error.
+//
+// If checkpoint isn't empty, each page is saved to the checkpoint file at
+// that path, and the pages already saved to it are read from it instead of
+// fetched. The file is removed once all pages are fetched.
+//
+// Its spans are children of parent, which may be nil.
+func fetchAll(parent Span, ch chan []Transaction, urlTemplate string, concurrency int, checkpoint string) (err error) {
+	start := time.Now()
+	defer metrics.fetchAll.since(start)
+
+	span := startSpan("fetch", parent)
+	span.SetAttributes(slog.String("urlTemplate", urlTemplate))
+	defer func() { span.End(err) }()
+
 	// Fetch the first page
-	p, err := fetchPage(pageURL(1, urlTemplate))
+	p, n, err := fetchPageIn(span, pageURL(1, urlTemplate))
 	if err != nil {
-		panic(err)
+		return err
+	}
+	totalCount := p.TotalCount
+	validatePage(p, 1, totalCount)
+
+	// Calculate the number of remaining pages to fetch
+	pageCount := numPages(totalCount)
+
+	// Resume from the checkpoint, which is only kept if fetching fails
+	var cp *Checkpoint
+	if checkpoint != "" {
+		if cp, err = OpenCheckpoint(checkpoint, urlTemplate, totalCount); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				err = cp.Remove()
+			} else {
+				cp.Close()
+			}
+		}()
+		if err = cp.Save(1, p.Transactions); err != nil {
+			return err
+		}
 	}
 
 	// Put the first page's transactions in the channel
 	ch <- p.Transactions
 
-	// Calculate the number of remaining pages to fetch
-	pageCount := int(
-		math.Floor(
-			float64(
-				(p.TotalCount-1)/transactionsPerPage,
-			),
-		) + 1,
+	// Put the checkpoint's pages in the channel, and keep track of
+	// which are left to fetch
+	var (
+		toFetch             []int
+		resumedPages        int
+		resumedTransactions int
+	)
+	for i := 2; i <= pageCount; i++ {
+		if cp != nil {
+			if ts, ok := cp.Transactions(i); ok {
+				ch <- ts
+				resumedPages++
+				resumedTransactions += len(ts)
+				continue
+			}
+		}
+		toFetch = append(toFetch, i)
+	}
+	if cp != nil {
+		Logger.Info("resumed from checkpoint", "path", checkpoint, "pages", resumedPages, "transactions", resumedTransactions)
+		span.SetAttributes(slog.Int("resumedPages", resumedPages))
+	}
+
+	// The first page's progress is reported once the number of pages is known
+	progress := newProgressTracker(start)
+	progress.setTotal(len(toFetch) + 1)
+	progress.add(n)
+
+	// Pages and transactions fetched, for the summary
+	var pages, transactions atomic.Int64
+	pages.Add(int64(1 + resumedPages))
+	transactions.Add(int64(len(p.Transactions) + resumedTransactions))
+
+	span.SetAttributes(slog.Int("pages", pageCount), slog.Int("totalCount", totalCount))
+
+	fetchErr := fetchPages(span, urlTemplate, toFetch, totalCount, concurrency, progress, func(i int, p *Page) error {
+		if cp != nil {
+			if err := cp.Save(i, p.Transactions); err != nil {
+				return err
+			}
+		}
+		pages.Add(1)
+		transactions.Add(int64(len(p.Transactions)))
+
+		// Put page's transactions in channel
+		ch <- p.Transactions
+		return nil
+	})
+	span.SetAttributes(slog.Int64("transactions", transactions.Load()))
+
+	if fetchErr == nil {
+		Logger.Info("fetched all pages", "pages", pages.Load(), "transactions", transactions.Load(), "duration", time.Since(start))
+		if n := transactions.Load(); n != int64(totalCount) {
+			Logger.Warn("number of transactions doesn't match the total count", "transactions", n, "totalCount", totalCount)
+		}
+	}
+	return fetchErr
+}
+
+// Fetches the pages concurrently in a fan-out span that's a child of parent,
+// validates them and calls got with each, counting them in progress. got is
+// called from the fetching go routines, so it must be safe to call
+// concurrently.
+//
+// It only launches as many go routines as concurrency at once. If fetching
+// a page, or got, fails, it stops launching go routines, waits for the
+// running ones to finish and returns the error.
+func fetchPages(parent Span, urlTemplate string, pages []int, totalCount, concurrency int, progress *progressTracker, got func(i int, p *Page) error) error {
+	var (
+		wg sync.WaitGroup
+		// The first error a child go routine encounters. Closing
+		// failed signals the loop to stop launching go routines.
+		fetchErr error
+		once     sync.Once
+		failed   = make(chan bool)
 	)
 
-	// Close the channel if there are no more pages
-	if pageCount < 2 {
-		close(ch)
-		return
+	// Stops launching go routines after the first error
+	fail := func(i int, err error) {
+		once.Do(func() {
+			Logger.Warn("stopped launching page fetches after an error", "page", i, "err", err)
+			fetchErr = err
+			close(failed)
+		})
 	}
 
-	// Initialize WaitGroup
-	var wg sync.WaitGroup
-	wg.Add(pageCount - 1)
+	// No more go routines than pages run at once
+	if concurrency > len(pages) {
+		Logger.Debug("lowered concurrency to the number of remaining pages", "concurrency", concurrency, "remaining", len(pages))
+		concurrency = max(len(pages), 1)
+	}
+	Logger.Info("fetching pages", "pages", len(pages), "totalCount", totalCount, "concurrency", concurrency)
+
+	// The pages are fetched in a span of their own
+	fanOut := startSpan("fan-out", parent)
+	fanOut.SetAttributes(slog.Int("pages", len(pages)), slog.Int("concurrency", concurrency))
 
-	// If an error occurs in a child go routine,
-	// send it over the channel and panic from the parent
-	done := make(chan error, 1)
 	// Semaphore to limit the number of go routines
 	sem := make(chan bool, concurrency)
 
-	for i := 2; i <= pageCount; i++ {
-		sem <- true // increment semaphore
+loop:
+	for _, i := range pages {
+		select {
+		case <-failed:
+			break loop
+		case sem <- true: // increment semaphore
+		}
+
+		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
 			// Fetch page
-			p, err := fetchPage(pageURL(i, urlTemplate))
+			p, n, err := fetchPageIn(fanOut, pageURL(i, urlTemplate))
 			if err != nil {
-				done <- err
+				fail(i, err)
 				return
 			}
-
-			// Put page's transactions in channel
-			ch <- p.Transactions
+			validatePage(p, i, totalCount)
+			if err := got(i, p); err != nil {
+				fail(i, err)
+				return
+			}
+			progress.add(n)
 		}(i)
 	}
 
-	// Wait for all go routines to finish then close the done channel
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+	// Wait for all go routines to finish
+	wg.Wait()
+	fanOut.End(fetchErr)
+	return fetchErr
+}
 
-	// Waits until an error or channel close.
-	// Panics if error. Otherwise closes the transactions channel
-	err = <-done
-	if err != nil {
-		panic(err)
+// Logs a warning for each inconsistency in page n: a page number other than
+// n, a total count other than the first page's, more transactions than a page
+// holds, and transactions without a date.
+func validatePage(p *Page, n, totalCount int) {
+	if p.Page != n {
+		Logger.Warn("page number doesn't match the requested page", "page", n, "got", p.Page)
+	}
+	if p.TotalCount != totalCount {
+		Logger.Warn("total count changed while fetching", "page", n, "totalCount", p.TotalCount, "firstPageTotalCount", totalCount)
+	}
+	if len(p.Transactions) > transactionsPerPage {
+		Logger.Warn("page has too many transactions", "page", n, "transactions", len(p.Transactions), "max", transactionsPerPage)
+	}
+	for i, t := range p.Transactions {
+		if t.Date.IsZero() {
+			Logger.Warn("transaction has no date", "page", n, "index", i, "company", t.Company, "amount", t.Amount)
+		}
 	}
-	close(ch)
 }
@@ -1,8 +1,10 @@
 package restTest
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"math"
 	"net/http"
 	"net/http/httptest"
@@ -305,6 +307,95 @@ func TestFetchAllPages(t *testing.T) {
 	wg.Wait()
 }
 
+func TestFetchAllLogs(t *testing.T) {
+	// Each mock page has 10 transactions, so 3 pages have more than 25
+	handler := restTestHandler{status: http.StatusOK, totalCount: 25}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	var buf bytes.Buffer
+	defer func(l *slog.Logger) { Logger = l }(Logger)
+	Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	ch := make(chan []Transaction)
+	go fetchAllTransactions(ch, mockServer.URL+"/%d", DefaultConcurrency)
+	for range ch {
+	}
+
+	var (
+		messages = make(map[string]int)
+		logs     []map[string]interface{}
+	)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var l map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q", line)
+		}
+		messages[l["msg"].(string)]++
+		logs = append(logs, l)
+	}
+
+	tests := []struct {
+		msg   string
+		count int
+	}{
+		{"fetched page", 3},
+		{"lowered concurrency to the number of remaining pages", 1},
+		{"fetching pages", 1},
+		{"fetched all pages", 1},
+		{"number of transactions doesn't match the total count", 1},
+	}
+	for _, tc := range tests {
+		if n := messages[tc.msg]; n != tc.count {
+			t.Errorf("Expected %d %q logs, got %d", tc.count, tc.msg, n)
+		}
+	}
+
+	for _, l := range logs {
+		switch l["msg"] {
+		case "fetched page":
+			for _, key := range []string{"url", "status", "duration", "bytes"} {
+				if _, ok := l[key]; !ok {
+					t.Errorf("Expected page request log to have %s, got %v", key, l)
+				}
+			}
+		case "fetching pages":
+			if c := l["concurrency"]; c != float64(2) {
+				t.Errorf("Expected concurrency 2 for the 2 remaining pages, got %v", c)
+			}
+		case "fetched all pages":
+			if n := l["transactions"]; n != float64(30) {
+				t.Errorf("Expected summary of 30 transactions, got %v", n)
+			}
+		}
+	}
+}
+
+func TestValidatePage(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *slog.Logger) { Logger = l }(Logger)
+	Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	p := mockPage
+	validatePage(&p, 1, 10)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no warnings for a valid page, got:\n%s", buf.String())
+	}
+
+	p.Transactions = append(append([]Transaction{}, p.Transactions...), Transaction{Company: "NO DATE"})
+	validatePage(&p, 2, 20)
+	for _, msg := range []string{
+		"page number doesn't match the requested page",
+		"total count changed while fetching",
+		"page has too many transactions",
+		"transaction has no date",
+	} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("Expected warning %q, got:\n%s", msg, buf.String())
+		}
+	}
+}
+
 func TestTransportString(t *testing.T) {
 	tr := Transaction{
 		Date:    newDate("2006-02-01"),
@@ -0,0 +1,145 @@
+package restTest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// DefaultForecastWindow is the default number of days the baseline
+	// moving average is calculated over.
+	DefaultForecastWindow = 30
+	// Number of standard deviations the confidence bands span (95%).
+	forecastConfidence = 1.96
+)
+
+// ForecastOptions configures a balance forecast.
+type ForecastOptions struct {
+	// Number of days to project after the last transaction.
+	Days int
+	// Number of days, ending on the last transaction's date, the baseline
+	// daily change is averaged over. Defaults to DefaultForecastWindow.
+	Window int
+	// Normalizes company names to detect recurring transactions. Optional.
+	Normalizer *Normalizer
+}
+
+// ForecastDay is a projected day's balance and its confidence band.
+type ForecastDay struct {
+	Date    Date
+	Balance money.Amount
+	// 95% confidence band of the balance.
+	Low  money.Amount
+	High money.Amount
+}
+
+// Forecast holds the running daily balances the forecast is based on,
+// followed by the projected ones.
+type Forecast struct {
+	History   DailyBalances
+	Projected []ForecastDay
+}
+
+// Returns the historical daily balances followed by the projected ones, which
+// are marked with a * and their confidence band.
+func (f Forecast) String() string {
+	var s []string
+	if len(f.History.days) > 0 {
+		s = append(s, f.History.String())
+	}
+	for _, d := range f.Projected {
+		s = append(s, fmt.Sprintf("%s:\t%s\t* [%s, %s]", d.Date.Format(dateTemplate), d.Balance, d.Low, d.High))
+	}
+	return strings.Join(s, "\n")
+}
+
+// BelowThreshold returns the first projected date whose balance is below
+// the threshold. The second value is false if the balance stays above it.
+func (f Forecast) BelowThreshold(threshold money.Amount) (Date, bool) {
+	for _, d := range f.Projected {
+		if d.Balance < threshold {
+			return d.Date, true
+		}
+	}
+	return Date{}, false
+}
+
+// ForecastBalances projects the running balance opts.Days days after the last
+// transaction. The projection adds the recurring transactions that are still
+// active (see DetectRecurring) on their expected dates, plus a baseline daily
+// change: the average daily net change of the other transactions over the
+// last opts.Window days. The confidence bands widen with the baseline's
+// day-to-day variation.
+func ForecastBalances(ts []Transaction, opts ForecastOptions) Forecast {
+	if opts.Window < 1 {
+		opts.Window = DefaultForecastWindow
+	}
+
+	f := Forecast{History: DailyBalancesFromTransactions(Slice(ts))}
+	if len(f.History.days) == 0 || opts.Days < 1 {
+		return f
+	}
+	last := f.History.days[len(f.History.days)-1]
+	balance := f.History.GetRunningBalance()
+
+	// Recurring transactions are projected on their own, so leave them
+	// out of the baseline
+	var (
+		series    = DetectRecurring(ts, opts.Normalizer, last)
+		recurring = make(map[Transaction]int)
+		scheduled = make(map[Date]money.Amount)
+		end       = Date{last.AddDate(0, 0, opts.Days)}
+	)
+	for _, r := range series {
+		for _, t := range r.Transactions {
+			recurring[t]++
+		}
+		if r.Status == Cancelled {
+			continue
+		}
+		for d := r.Next; !d.After(end.Time); d = r.Cadence.Next(d) {
+			if d.After(last.Time) {
+				scheduled[d] += r.Average
+			}
+		}
+	}
+
+	// Daily net change of the other transactions over the window,
+	// counting days without transactions as no change
+	changes := make([]float64, opts.Window)
+	start := last.AddDate(0, 0, -opts.Window+1)
+	for _, t := range ts {
+		if recurring[t] > 0 {
+			recurring[t]--
+			continue
+		}
+		if t.Date.Before(start) {
+			continue
+		}
+		day := int(t.Date.Sub(start).Hours() / 24)
+		changes[day] += float64(t.Amount)
+	}
+	mean, stdDev := meanStdDev(changes)
+
+	for k := 1; k <= opts.Days; k++ {
+		d := Date{last.AddDate(0, 0, k)}
+		expected := float64(balance) + mean*float64(k)
+		for day, amount := range scheduled {
+			if !day.After(d.Time) {
+				expected += float64(amount)
+			}
+		}
+		band := forecastConfidence * stdDev * math.Sqrt(float64(k))
+
+		f.Projected = append(f.Projected, ForecastDay{
+			Date:    d,
+			Balance: money.Amount(math.Round(expected)),
+			Low:     money.Amount(math.Round(expected - band)),
+			High:    money.Amount(math.Round(expected + band)),
+		})
+	}
+	return f
+}
@@ -0,0 +1,87 @@
+package restTest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestForecastBalances(t *testing.T) {
+	// Opening deposit, monthly hosting and a steady -10.00 a day
+	ts := []Transaction{{newDate("2013-09-01"), "", 100000, "DEPOSIT"}}
+	ts = append(ts, series("GROWINGCITY.COM xxxxxx4926 BC", -6000, "2013-09-12", Monthly, 4)...)
+	for d := newDate("2013-11-15"); !d.After(newDate("2013-12-14").Time); d = (Date{d.AddDate(0, 0, 1)}) {
+		ts = append(ts, Transaction{d, "Office Expense", -1000, "FEDEX"})
+	}
+
+	f := ForecastBalances(ts, ForecastOptions{Days: 31})
+	if n := len(f.Projected); n != 31 {
+		t.Fatalf("Expected %d projected days, got %d", 31, n)
+	}
+
+	// History ends at 1000.00 - 4 * 60.00 - 30 * 10.00 = 460.00
+	if b := f.History.GetRunningBalance(); b != 46000 {
+		t.Fatalf("Expected last balance 460.00, got %s", b)
+	}
+
+	tests := []struct {
+		date     string
+		expected money.Amount
+	}{
+		{"2013-12-15", 45000},
+		// Hosting is due on the 12th
+		{"2014-01-12", 46000 - 29*1000 - 6000},
+		{"2014-01-14", 46000 - 31*1000 - 6000},
+	}
+	for _, tc := range tests {
+		var day *ForecastDay
+		for i := range f.Projected {
+			if f.Projected[i].Date.Format(dateTemplate) == tc.date {
+				day = &f.Projected[i]
+			}
+		}
+		if day == nil {
+			t.Fatalf("Expected %s to be projected", tc.date)
+		}
+		if day.Balance != tc.expected {
+			t.Errorf("Expected %s balance %s, got %s", tc.date, tc.expected, day.Balance)
+		}
+		// The baseline doesn't vary, so neither does the band
+		if day.Low != day.Balance || day.High != day.Balance {
+			t.Errorf("Expected no confidence band, got [%s, %s]", day.Low, day.High)
+		}
+	}
+
+	d, ok := f.BelowThreshold(20000)
+	if !ok || d.Format(dateTemplate) != "2014-01-10" {
+		t.Errorf("Expected balance to go below 200.00 on 2014-01-10, got %v %v", d, ok)
+	}
+	if _, ok := f.BelowThreshold(-100000); ok {
+		t.Error("Expected balance not to go below -1000.00")
+	}
+
+	if s := f.String(); !strings.Contains(s, "2013-12-14:\t460.00\n2013-12-15:\t450.00\t* [450.00, 450.00]") {
+		t.Errorf("Expected projected rows to follow history with a marker, got:\n%s", s)
+	}
+}
+
+func TestForecastConfidenceBands(t *testing.T) {
+	var ts []Transaction
+	for i, d := 0, newDate("2013-12-01"); i < 30; i, d = i+1, (Date{d.AddDate(0, 0, 1)}) {
+		ts = append(ts, Transaction{d, "Office Expense", money.Amount(-1000 * (i % 3)), "FEDEX"})
+	}
+
+	f := ForecastBalances(ts, ForecastOptions{Days: 10})
+	prev := money.Amount(0)
+	for _, d := range f.Projected {
+		if d.Low >= d.Balance || d.High <= d.Balance {
+			t.Errorf("Expected %s balance %s inside its band [%s, %s]", d.Date.Format(dateTemplate), d.Balance, d.Low, d.High)
+		}
+		if width := d.High - d.Low; width <= prev {
+			t.Errorf("Expected the band to widen over time, got %s after %s", width, prev)
+		} else {
+			prev = width
+		}
+	}
+}
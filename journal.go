@@ -0,0 +1,150 @@
+package restTest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JournalOptions configures plain-text accounting exports.
+type JournalOptions struct {
+	// Account on the other side of every transaction, whose running balance
+	// is asserted at the end of each day. Defaults to Assets:Bank.
+	Account string
+	// Commodity of the amounts. Defaults to CAD.
+	Currency string
+}
+
+// Returns the options with their defaults filled in.
+func (o JournalOptions) withDefaults() JournalOptions {
+	if o.Account == "" {
+		o.Account = "Assets:Bank"
+	}
+	if o.Currency == "" {
+		o.Currency = "CAD"
+	}
+	return o
+}
+
+// LedgerAccount returns the expense or income account of the transaction's
+// ledger. Ex. "Phone & Internet Expense" becomes Expenses:Phone-Internet.
+// Ledgers ending in Expense go under Expenses and those ending in Income or
+// Revenue go under Income; otherwise the amount's sign decides. Transactions
+// without a ledger go to Expenses:Uncategorized or Income:Uncategorized.
+func LedgerAccount(t Transaction) string {
+	words := strings.Fields(t.Ledger)
+
+	root := "Expenses"
+	if t.Amount > 0 {
+		root = "Income"
+	}
+	if n := len(words); n > 0 {
+		switch strings.ToLower(words[n-1]) {
+		case "expense", "expenses":
+			root, words = "Expenses", words[:n-1]
+		case "income", "revenue":
+			root, words = "Income", words[:n-1]
+		}
+	}
+
+	// Account names may only hold letters, digits and dashes and must
+	// start with a capital letter or digit
+	var parts []string
+	for _, w := range words {
+		w = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+				return r
+			}
+			return -1
+		}, w)
+		if w == "" {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		parts = append(parts, string(r))
+	}
+	if len(parts) == 0 {
+		parts = []string{"Uncategorized"}
+	}
+
+	return root + ":" + strings.Join(parts, "-")
+}
+
+// Returns a copy of the transactions sorted by date, keeping the
+// order of same day transactions, and their running daily balances.
+func journalEntries(ts []Transaction) ([]Transaction, DailyBalances) {
+	sorted := make([]Transaction, len(ts))
+	copy(sorted, ts)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date.Time) })
+	return sorted, DailyBalancesFromTransactions(Slice(ts))
+}
+
+// WriteLedger writes the transactions as a ledger-cli (and hledger) journal.
+// Each transaction posts its amount to opts.Account and the opposite to its
+// ledger's account. The last posting of each day asserts opts.Account's
+// running balance.
+func WriteLedger(w io.Writer, ts []Transaction, opts JournalOptions) error {
+	opts = opts.withDefaults()
+	sorted, db := journalEntries(ts)
+
+	bw := bufio.NewWriter(w)
+	for i, t := range sorted {
+		fmt.Fprintf(bw, "%s %s\n", t.Date.Format(dateTemplate), t.Company)
+		// ledger-cli and hledger need at least two spaces between the account and amount
+		fmt.Fprintf(bw, "    %-39s  %12s %s\n", LedgerAccount(t), -t.Amount, opts.Currency)
+		fmt.Fprintf(bw, "    %-39s  %12s %s", opts.Account, t.Amount, opts.Currency)
+
+		// Assert the balance after the day's last transaction
+		if i == len(sorted)-1 || !sorted[i+1].Date.Equal(t.Date.Time) {
+			fmt.Fprintf(bw, " = %s %s", db.balances[t.Date], opts.Currency)
+		}
+		fmt.Fprint(bw, "\n\n")
+	}
+	return bw.Flush()
+}
+
+// WriteBeancount writes the transactions as a beancount file. It opens the
+// accounts on the first transaction's date and, since beancount checks
+// balances at the start of the day, asserts opts.Account's running balance
+// at the end of each day with a balance directive on the next day.
+func WriteBeancount(w io.Writer, ts []Transaction, opts JournalOptions) error {
+	opts = opts.withDefaults()
+	sorted, db := journalEntries(ts)
+
+	bw := bufio.NewWriter(w)
+	if len(sorted) > 0 {
+		// Open every account used, sorted by name
+		accounts := map[string]bool{opts.Account: true}
+		for _, t := range sorted {
+			accounts[LedgerAccount(t)] = true
+		}
+		names := make([]string, 0, len(accounts))
+		for a := range accounts {
+			names = append(names, a)
+		}
+		sort.Strings(names)
+
+		opened := sorted[0].Date.Format(dateTemplate)
+		for _, a := range names {
+			fmt.Fprintf(bw, "%s open %s %s\n", opened, a, opts.Currency)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	for i, t := range sorted {
+		fmt.Fprintf(bw, "%s * %s\n", t.Date.Format(dateTemplate), strconv.Quote(t.Company))
+		fmt.Fprintf(bw, "  %-40s %12s %s\n", LedgerAccount(t), -t.Amount, opts.Currency)
+		fmt.Fprintf(bw, "  %-40s %12s %s\n\n", opts.Account, t.Amount, opts.Currency)
+
+		if i == len(sorted)-1 || !sorted[i+1].Date.Equal(t.Date.Time) {
+			fmt.Fprintf(bw, "%s balance %s %s %s\n\n",
+				t.Date.AddDate(0, 0, 1).Format(dateTemplate), opts.Account, db.balances[t.Date], opts.Currency)
+		}
+	}
+	return bw.Flush()
+}
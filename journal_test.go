@@ -0,0 +1,108 @@
+package restTest
+
+import (
+	"bytes"
+	"testing"
+)
+
+var journalTransactions = []Transaction{
+	{newDate("2013-12-13"), "Equipment Expense", -551817, "APPLE STORE #R280 VANCOUVER BC"},
+	{newDate("2013-12-12"), "Phone & Internet Expense", -11071, "SHAW CABLESYSTEMS CALGARY AB"},
+	{newDate("2013-12-12"), "", 1000000, "CLIENT \"A\" PAYMENT"},
+}
+
+func TestLedgerAccount(t *testing.T) {
+	tests := []struct {
+		in       Transaction
+		expected string
+	}{
+		{Transaction{Ledger: "Phone & Internet Expense", Amount: -1}, "Expenses:Phone-Internet"},
+		{Transaction{Ledger: "Business Meals & Entertainment Expense", Amount: -1}, "Expenses:Business-Meals-Entertainment"},
+		{Transaction{Ledger: "Web Hosting & Services Expense", Amount: 1}, "Expenses:Web-Hosting-Services"},
+		{Transaction{Ledger: "consulting revenue", Amount: 1}, "Income:Consulting"},
+		{Transaction{Ledger: "Refunds", Amount: 1}, "Income:Refunds"},
+		{Transaction{Ledger: "", Amount: -1}, "Expenses:Uncategorized"},
+		{Transaction{Ledger: "Expense", Amount: -1}, "Expenses:Uncategorized"},
+	}
+
+	for _, tc := range tests {
+		if actual := LedgerAccount(tc.in); actual != tc.expected {
+			t.Errorf("Expected account %s for ledger %q, got %s", tc.expected, tc.in.Ledger, actual)
+		}
+	}
+}
+
+func TestWriteLedger(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteLedger(&b, journalTransactions, JournalOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `2013-12-12 SHAW CABLESYSTEMS CALGARY AB
+    Expenses:Phone-Internet                        110.71 CAD
+    Assets:Bank                                   -110.71 CAD
+
+2013-12-12 CLIENT "A" PAYMENT
+    Income:Uncategorized                        -10000.00 CAD
+    Assets:Bank                                  10000.00 CAD = 9889.29 CAD
+
+2013-12-13 APPLE STORE #R280 VANCOUVER BC
+    Expenses:Equipment                            5518.17 CAD
+    Assets:Bank                                  -5518.17 CAD = 4371.12 CAD
+
+`
+	if actual := b.String(); actual != expected {
+		t.Errorf("Expected journal:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestWriteLedgerLongAccount(t *testing.T) {
+	ts := []Transaction{{newDate("2013-12-12"), "Office Supplies and Furniture Rentals Expense", -12345678901, "STAPLES"}}
+	var b bytes.Buffer
+	if err := WriteLedger(&b, ts, JournalOptions{Account: "Assets:Bank"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The account fills its column, so only the two spaces separate it from the amount
+	expected := `2013-12-12 STAPLES
+    Expenses:Office-Supplies-And-Furniture-Rentals  123456789.01 CAD
+    Assets:Bank                              -123456789.01 CAD = -123456789.01 CAD
+
+`
+	if actual := b.String(); actual != expected {
+		t.Errorf("Expected journal:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestWriteBeancount(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteBeancount(&b, journalTransactions, JournalOptions{Account: "Assets:Checking", Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `2013-12-12 open Assets:Checking USD
+2013-12-12 open Expenses:Equipment USD
+2013-12-12 open Expenses:Phone-Internet USD
+2013-12-12 open Income:Uncategorized USD
+
+2013-12-12 * "SHAW CABLESYSTEMS CALGARY AB"
+  Expenses:Phone-Internet                        110.71 USD
+  Assets:Checking                               -110.71 USD
+
+2013-12-12 * "CLIENT \"A\" PAYMENT"
+  Income:Uncategorized                        -10000.00 USD
+  Assets:Checking                              10000.00 USD
+
+2013-12-13 balance Assets:Checking 9889.29 USD
+
+2013-12-13 * "APPLE STORE #R280 VANCOUVER BC"
+  Expenses:Equipment                            5518.17 USD
+  Assets:Checking                              -5518.17 USD
+
+2013-12-14 balance Assets:Checking 4371.12 USD
+
+`
+	if actual := b.String(); actual != expected {
+		t.Errorf("Expected beancount file:\n%s\nGot:\n%s", expected, actual)
+	}
+}
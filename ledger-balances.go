@@ -0,0 +1,157 @@
+package restTest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Name given to transactions with an empty ledger.
+const uncategorized = "Uncategorized"
+
+// MonthTotal is the sum of a month's transaction amounts.
+type MonthTotal struct {
+	// First day of the month.
+	Month Date
+	Total money.Amount
+}
+
+// LedgerBalance holds the totals of a single ledger's transactions.
+type LedgerBalance struct {
+	Ledger string
+	// Sum of the ledger's transaction amounts.
+	Total money.Amount
+	// Number of transactions.
+	Count int
+	// Fraction (0 to 1) of all outflows (negative amounts) that went to this ledger.
+	Share float64
+	// Totals of each month with transactions, sorted by month.
+	Months []MonthTotal
+	// Running daily balances of the ledger's transactions.
+	Daily DailyBalances
+}
+
+// LedgerBalances data structure for representing ledgers and their balances.
+// Ledgers are sorted by spend, the one with the most negative total first.
+type LedgerBalances struct {
+	ledgers  []string
+	balances map[string]*LedgerBalance
+}
+
+// Ledgers returns the ledger names sorted by spend.
+func (lb LedgerBalances) Ledgers() []string {
+	return lb.ledgers
+}
+
+// Get returns the ledger's balance. The second value is false if no
+// transaction belongs to the ledger.
+func (lb LedgerBalances) Get(ledger string) (LedgerBalance, bool) {
+	if ledger == "" {
+		ledger = uncategorized
+	}
+	b, ok := lb.balances[ledger]
+	if !ok {
+		return LedgerBalance{}, false
+	}
+	return *b, true
+}
+
+// Returns each ledger's total, share of spend, count and monthly trend formatted as a table.
+func (lb LedgerBalances) String() string {
+	var s []string
+	s = append(s, fmt.Sprintf("%-40s %12s %7s %6s", "Ledger", "Total", "Share", "Count"))
+	for _, l := range lb.ledgers {
+		b := lb.balances[l]
+		s = append(s, fmt.Sprintf("%-40s %12s %6.1f%% %6d", l, b.Total, b.Share*100, b.Count))
+		for _, m := range b.Months {
+			s = append(s, fmt.Sprintf("  %-38s %12s", m.Month.Format("2006-01"), m.Total))
+		}
+	}
+	return strings.Join(s, "\n")
+}
+
+// Returns the first day of the date's month.
+func monthOf(d Date) Date {
+	return Date{time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, d.Location())}
+}
+
+// LedgerBalancesFromTransactions receives transaction slices from the source and
+// calculates the totals and running daily balances of each ledger. Transactions
+// with an empty ledger are grouped under "Uncategorized". It returns after the
+// source's channel is closed. Check the source's Err to know whether it read all
+// transactions.
+func LedgerBalancesFromTransactions(src Source) LedgerBalances {
+	var (
+		lb = LedgerBalances{balances: make(map[string]*LedgerBalance)}
+		// Monthly totals of each ledger before they're sorted
+		months = make(map[string]map[Date]money.Amount)
+		// Sum of all negative amounts
+		outflows money.Amount
+		// Sum of each ledger's negative amounts
+		ledgerOutflows = make(map[string]money.Amount)
+	)
+
+	for ts := range src.Transactions() {
+		for _, t := range ts {
+			l := t.Ledger
+			if l == "" {
+				l = uncategorized
+			}
+
+			b, ok := lb.balances[l]
+			if !ok {
+				b = &LedgerBalance{
+					Ledger: l,
+					Daily:  DailyBalances{balances: make(map[Date]money.Amount)},
+				}
+				lb.balances[l] = b
+				lb.ledgers = append(lb.ledgers, l)
+				months[l] = make(map[Date]money.Amount)
+			}
+
+			b.Total += t.Amount
+			b.Count++
+			months[l][monthOf(t.Date)] += t.Amount
+
+			// if day doesn't already exist, add it to the days slice
+			if _, ok := b.Daily.balances[t.Date]; !ok {
+				b.Daily.days = append(b.Daily.days, t.Date)
+			}
+			b.Daily.balances[t.Date] += t.Amount
+
+			if t.Amount < 0 {
+				outflows += t.Amount
+				ledgerOutflows[l] += t.Amount
+			}
+		}
+	}
+
+	for _, l := range lb.ledgers {
+		b := lb.balances[l]
+		if outflows != 0 {
+			b.Share = float64(ledgerOutflows[l]) / float64(outflows)
+		}
+
+		for m, total := range months[l] {
+			b.Months = append(b.Months, MonthTotal{m, total})
+		}
+		sort.Slice(b.Months, func(i, j int) bool { return b.Months[i].Month.Before(b.Months[j].Month.Time) })
+
+		b.Daily.Sort()
+		b.Daily.setRunningDailyBalances()
+	}
+
+	// Sort by spend, breaking ties by name
+	sort.Slice(lb.ledgers, func(i, j int) bool {
+		bi, bj := lb.balances[lb.ledgers[i]], lb.balances[lb.ledgers[j]]
+		if bi.Total != bj.Total {
+			return bi.Total < bj.Total
+		}
+		return bi.Ledger < bj.Ledger
+	})
+
+	return lb
+}
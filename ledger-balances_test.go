@@ -0,0 +1,75 @@
+package restTest
+
+import (
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+var ledgerTransactions = Slice{
+	{newDate("2013-12-13"), "Equipment Expense", -551817, "APPLE STORE #R280 VANCOUVER BC"},
+	{newDate("2013-12-12"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+	{newDate("2014-01-12"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+	{newDate("2013-12-20"), "Equipment Expense", -187475, "NINJA STAR WORLD VANCOUVER BC"},
+	{newDate("2013-12-22"), "", 10000, "PAYMENT"},
+}
+
+func TestLedgerBalancesFromTransactions(t *testing.T) {
+	lb := LedgerBalancesFromTransactions(ledgerTransactions)
+
+	expected := []string{"Equipment Expense", "Office Expense", uncategorized}
+	ledgers := lb.Ledgers()
+	if len(ledgers) != len(expected) {
+		t.Fatalf("Expected ledgers %v, got %v", expected, ledgers)
+	}
+	for i, l := range expected {
+		if ledgers[i] != l {
+			t.Errorf("Expected ledger %d to be %s, got %s", i, l, ledgers[i])
+		}
+	}
+
+	equipment, _ := lb.Get("Equipment Expense")
+	if expected := money.Amount(-739292); equipment.Total != expected {
+		t.Errorf("Expected total %s, got %s", expected, equipment.Total)
+	}
+	if equipment.Count != 2 {
+		t.Errorf("Expected count %d, got %d", 2, equipment.Count)
+	}
+	if share := equipment.Share; share < 0.988 || share > 0.989 {
+		t.Errorf("Expected share of about 0.9886, got %f", share)
+	}
+	if expected := "2013-12-13:\t-5518.17\n2013-12-20:\t-7392.92"; equipment.Daily.String() != expected {
+		t.Errorf("Expected daily balances:\n%s\nGot:\n%s", expected, equipment.Daily)
+	}
+
+	office, _ := lb.Get("Office Expense")
+	if len(office.Months) != 2 || office.Months[0].Month != newDate("2013-12-01") || office.Months[1].Total != -4253 {
+		t.Errorf("Expected monthly totals for 2013-12 and 2014-01, got %v", office.Months)
+	}
+
+	// Income has no share of spend
+	income, ok := lb.Get("")
+	if !ok || income.Share != 0 {
+		t.Errorf("Expected uncategorized ledger with no share of spend, got %+v", income)
+	}
+
+	if _, ok := lb.Get("Missing"); ok {
+		t.Error("Expected a missing ledger not to be found")
+	}
+}
+
+func TestLedgerBalancesString(t *testing.T) {
+	lb := LedgerBalancesFromTransactions(Slice{
+		{newDate("2013-12-13"), "Equipment Expense", -3000, "APPLE"},
+		{newDate("2013-12-12"), "Office Expense", -1000, "FEDEX"},
+	})
+
+	expected := "Ledger                                          Total   Share  Count\n" +
+		"Equipment Expense                              -30.00   75.0%      1\n" +
+		"  2013-12                                      -30.00\n" +
+		"Office Expense                                 -10.00   25.0%      1\n" +
+		"  2013-12                                      -10.00"
+	if actual := lb.String(); actual != expected {
+		t.Errorf("Expected report:\n%s\nGot:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,201 @@
+package restTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+var (
+	// Masked card or account numbers and amounts. Ex. xxxxx5291, xx8.80, ****1234
+	maskedPattern = regexp.MustCompile(`^[xX*]+[0-9.]*$|^[0-9]*[xX*]{2,}[0-9.]*$`)
+	// Store numbers. Ex. #R280, #x0064
+	storePattern = regexp.MustCompile(`^#\S*$`)
+	// Numbers, which are store numbers once the name has started. Ex. 78
+	numberPattern = regexp.MustCompile(`^[0-9]+$`)
+	// Currency codes that start a foreign currency annotation. Ex. USD @ xx0878
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+	// Canadian province and territory codes, plus the country codes that
+	// some banks put in their place.
+	provinces = map[string]bool{
+		"AB": true, "BC": true, "MB": true, "NB": true, "NL": true, "NS": true, "NT": true,
+		"NU": true, "ON": true, "PE": true, "QC": true, "SK": true, "YT": true,
+		"CA": true, "US": true,
+	}
+)
+
+// MerchantRule renames the companies its regular expression matches.
+type MerchantRule struct {
+	// Regular expression matched against the company string as is.
+	Match string `json:"match"`
+	// Merchant name given to matching companies.
+	Name string `json:"name"`
+
+	re *regexp.Regexp
+}
+
+// Normalizer maps company strings to merchant names, so that the same merchant
+// shows up under one name. Its zero value only applies the built-in cleanup.
+type Normalizer struct {
+	rules []MerchantRule
+}
+
+// NewNormalizer returns a normalizer that tries the rules, in order,
+// before the built-in cleanup.
+func NewNormalizer(rules []MerchantRule) (*Normalizer, error) {
+	n := &Normalizer{rules: make([]MerchantRule, len(rules))}
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("merchant rule %d: %v", i+1, err)
+		}
+		r.re = re
+		n.rules[i] = r
+	}
+	return n, nil
+}
+
+// LoadNormalizer reads merchant rules from a JSON file holding an array of
+// {"match": "regexp", "name": "merchant"} objects.
+func LoadNormalizer(path string) (*Normalizer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []MerchantRule
+	if err = json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	n, err := NewNormalizer(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return n, nil
+}
+
+// Normalize returns the merchant name of the company. The first rule that
+// matches decides the name. Otherwise it strips, in turn, foreign currency
+// annotations, masked numbers, store numbers and a trailing province code
+// along with the city before it. Ex. "FEDEX xxxxx5291 MISSISSAUGA ON" becomes
+// "FEDEX" and "APPLE STORE #R280 VANCOUVER BC" becomes "APPLE STORE".
+//
+// The city is taken to be the single word before the province code, so
+// multi-word cities need a rule of their own.
+func (n *Normalizer) Normalize(company string) string {
+	if n != nil {
+		for _, r := range n.rules {
+			if r.re.MatchString(company) {
+				return r.Name
+			}
+		}
+	}
+
+	var (
+		words = strings.Fields(strings.ToUpper(company))
+		kept  []string
+		// Whether a word other than a number was kept. Numbers before it are
+		// part of the name. Ex. 7 ELEVEN, 1 800 FLOWERS
+		named bool
+	)
+	for i, w := range words {
+		// Drop the rest once a currency annotation starts. Ex. 8.80 USD @ 0878
+		if currencyPattern.MatchString(w) && i+1 < len(words) && words[i+1] == "@" {
+			break
+		}
+		number := numberPattern.MatchString(w)
+		if maskedPattern.MatchString(w) || storePattern.MatchString(w) || number && named {
+			continue
+		}
+		named = named || !number
+		kept = append(kept, w)
+	}
+
+	// Strip the trailing province and city, keeping at least one word
+	if k := len(kept); k > 1 && provinces[kept[k-1]] {
+		kept = kept[:k-1]
+		if k > 2 {
+			kept = kept[:k-2]
+		}
+	}
+
+	if len(kept) == 0 {
+		return strings.TrimSpace(company)
+	}
+	return strings.Join(kept, " ")
+}
+
+// MerchantTotal holds the totals of a merchant's transactions.
+type MerchantTotal struct {
+	Merchant string
+	// Sum of the merchant's transaction amounts.
+	Total money.Amount
+	// Number of transactions.
+	Count int
+	// Company strings that were normalized into this merchant, sorted.
+	Companies []string
+}
+
+// MerchantTotals is a list of merchants sorted by spend.
+type MerchantTotals []MerchantTotal
+
+// Returns each merchant's total, count and average formatted as a table.
+func (mt MerchantTotals) String() string {
+	var s []string
+	s = append(s, fmt.Sprintf("%-40s %12s %6s %12s", "Merchant", "Total", "Count", "Average"))
+	for _, m := range mt {
+		s = append(s, fmt.Sprintf("%-40s %12s %6d %12s", m.Merchant, m.Total, m.Count, m.Total/money.Amount(m.Count)))
+	}
+	return strings.Join(s, "\n")
+}
+
+// TopMerchants groups the transactions by merchant, as normalized by n, and
+// returns the limit merchants with the most spend (the most negative total),
+// breaking ties by the number of transactions. A limit below 1 returns all.
+func TopMerchants(ts []Transaction, n *Normalizer, limit int) MerchantTotals {
+	var (
+		totals    = make(map[string]*MerchantTotal)
+		companies = make(map[string]map[string]bool)
+	)
+	for _, t := range ts {
+		name := n.Normalize(t.Company)
+		m, ok := totals[name]
+		if !ok {
+			m = &MerchantTotal{Merchant: name}
+			totals[name] = m
+			companies[name] = make(map[string]bool)
+		}
+		m.Total += t.Amount
+		m.Count++
+		companies[name][t.Company] = true
+	}
+
+	mt := make(MerchantTotals, 0, len(totals))
+	for name, m := range totals {
+		for c := range companies[name] {
+			m.Companies = append(m.Companies, c)
+		}
+		sort.Strings(m.Companies)
+		mt = append(mt, *m)
+	}
+	sort.Slice(mt, func(i, j int) bool {
+		if mt[i].Total != mt[j].Total {
+			return mt[i].Total < mt[j].Total
+		}
+		if mt[i].Count != mt[j].Count {
+			return mt[i].Count > mt[j].Count
+		}
+		return mt[i].Merchant < mt[j].Merchant
+	})
+
+	if limit > 0 && len(mt) > limit {
+		mt = mt[:limit]
+	}
+	return mt
+}
@@ -0,0 +1,94 @@
+package restTest
+
+import (
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"FEDEX xxxxx5291 MISSISSAUGA ON", "FEDEX"},
+		{"APPLE STORE #R280 VANCOUVER BC", "APPLE STORE"},
+		{"ECHOSIGN xxxxxxxx6744 CA xx8.80 USD @ xx0878", "ECHOSIGN"},
+		{"NESTERS MARKET #x0064 VANCOUVER BC", "NESTERS MARKET"},
+		{"GROWINGCITY.COM xxxxxx4926 BC", "GROWINGCITY.COM"},
+		{"SHAW CABLESYSTEMS CALGARY AB", "SHAW CABLESYSTEMS"},
+		{"DHL YVR GW RICHMOND BC", "DHL YVR GW"},
+		{"LONDON DRUGS 78 POSTAL VANCOUVER BC", "LONDON DRUGS POSTAL"},
+		{"7 ELEVEN STORE 34012 VANCOUVER BC", "7 ELEVEN STORE"},
+		{"1 800 FLOWERS", "1 800 FLOWERS"},
+		{"1 800 FLOWERS #555 TORONTO ON", "1 800 FLOWERS"},
+		{"Payment", "PAYMENT"},
+		{"xxxx1234", "xxxx1234"},
+	}
+
+	var n *Normalizer
+	for _, tc := range tests {
+		if actual := n.Normalize(tc.in); actual != tc.expected {
+			t.Errorf("Expected %q to normalize to %q, got %q", tc.in, tc.expected, actual)
+		}
+	}
+}
+
+func TestNormalizerRules(t *testing.T) {
+	path := writeTemp(t, "merchants.json", `[
+		{"match": "^LONDON DRUGS", "name": "LONDON DRUGS"},
+		{"match": "(?i)amzn|amazon", "name": "AMAZON"}
+	]`)
+	n, err := LoadNormalizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"LONDON DRUGS 78 POSTAL VANCOUVER BC", "LONDON DRUGS"},
+		{"Amzn Mktp CA", "AMAZON"},
+		{"FEDEX xxxxx5291 MISSISSAUGA ON", "FEDEX"},
+	}
+	for _, tc := range tests {
+		if actual := n.Normalize(tc.in); actual != tc.expected {
+			t.Errorf("Expected %q to normalize to %q, got %q", tc.in, tc.expected, actual)
+		}
+	}
+
+	if _, err := NewNormalizer([]MerchantRule{{Match: "(", Name: "X"}}); err == nil {
+		t.Error("Expected an invalid regular expression to fail")
+	}
+}
+
+func TestTopMerchants(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-12"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		{newDate("2013-12-13"), "Office Expense", -1000, "FEDEX xxxxx1234 VANCOUVER BC"},
+		{newDate("2013-12-13"), "Equipment Expense", -551817, "APPLE STORE #R280 VANCOUVER BC"},
+		{newDate("2013-12-14"), "Office Expense", -5253, "DHL YVR GW RICHMOND BC"},
+	}
+
+	mt := TopMerchants(ts, nil, 2)
+	if len(mt) != 2 {
+		t.Fatalf("Expected %d merchants, got %d", 2, len(mt))
+	}
+	if mt[0].Merchant != "APPLE STORE" {
+		t.Errorf("Expected top merchant %s, got %s", "APPLE STORE", mt[0].Merchant)
+	}
+
+	// FEDEX and DHL have the same total; FEDEX has more transactions
+	fedex := mt[1]
+	if fedex.Merchant != "FEDEX" || fedex.Total != money.Amount(-5253) || fedex.Count != 2 {
+		t.Errorf("Expected FEDEX with total -52.53 over 2 transactions, got %+v", fedex)
+	}
+	if len(fedex.Companies) != 2 || fedex.Companies[0] != "FEDEX xxxxx1234 VANCOUVER BC" {
+		t.Errorf("Expected both FEDEX company strings, got %v", fedex.Companies)
+	}
+
+	if all := TopMerchants(ts, nil, 0); len(all) != 3 {
+		t.Errorf("Expected %d merchants, got %d", 3, len(all))
+	}
+}
@@ -0,0 +1,205 @@
+package restTest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds, in seconds, of the request latency histogram's buckets.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Upper bounds, in seconds, of the fetch duration histogram's buckets.
+var fetchBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// The metrics collected while fetching and aggregating transactions.
+var metrics = struct {
+	pagesFetched *counter
+	responses    *counter
+	fetchErrors  *counter
+	bytesRead    *counter
+	latency      *histogram
+	fetchAll     *histogram
+	transactions *counter
+	totalBalance *gauge
+	cache        *counter
+}{
+	pagesFetched: newCounter("resttest_pages_fetched_total", "Pages fetched and decoded.", ""),
+	responses:    newCounter("resttest_http_responses_total", "HTTP responses by status code.", "code"),
+	fetchErrors:  newCounter("resttest_fetch_errors_total", "Page fetches that failed.", ""),
+	bytesRead:    newCounter("resttest_response_bytes_total", "Bytes read from page response bodies.", ""),
+	latency:      newHistogram("resttest_request_duration_seconds", "Page request latency, until the body is read.", latencyBuckets),
+	fetchAll:     newHistogram("resttest_fetch_all_duration_seconds", "Time to fetch all pages.", fetchBuckets),
+	transactions: newCounter("resttest_transactions_processed_total", "Transactions added to daily balances.", ""),
+	totalBalance: newGauge("resttest_total_balance", "Running balance of the last daily balances calculated, in dollars."),
+	cache:        newCounter("resttest_cache_requests_total", "Page requests through the response cache by result: hit, revalidated or miss.", "result"),
+}
+
+// WriteMetrics writes the metrics collected while fetching and aggregating
+// transactions in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer) error {
+	var b strings.Builder
+	metrics.pagesFetched.write(&b)
+	metrics.responses.write(&b)
+	metrics.fetchErrors.write(&b)
+	metrics.bytesRead.write(&b)
+	metrics.latency.write(&b)
+	metrics.fetchAll.write(&b)
+	metrics.transactions.write(&b)
+	metrics.totalBalance.write(&b)
+	metrics.cache.write(&b)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// MetricsHandler returns a handler that responds with the metrics in the
+// Prometheus text exposition format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+}
+
+// counter is a monotonically increasing metric, optionally with one label.
+type counter struct {
+	name, help, label string
+
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func newCounter(name, help, label string) *counter {
+	return &counter{name: name, help: help, label: label, values: make(map[string]float64)}
+}
+
+// Adds v to the value of the label value, which is ignored without a label.
+func (c *counter) add(labelValue string, v float64) {
+	c.mutex.Lock()
+	c.values[labelValue] += v
+	c.mutex.Unlock()
+}
+
+// Returns the value of the label value.
+func (c *counter) get(labelValue string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[labelValue]
+}
+
+func (c *counter) write(b *strings.Builder) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if c.label == "" {
+		fmt.Fprintf(b, "%s %s\n", c.name, formatFloat(c.values[""]))
+		return
+	}
+	labels := make([]string, 0, len(c.values))
+	for l := range c.values {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		fmt.Fprintf(b, "%s{%s=%q} %s\n", c.name, c.label, l, formatFloat(c.values[l]))
+	}
+}
+
+// gauge is a metric that can go up and down.
+type gauge struct {
+	name, help string
+
+	mutex sync.Mutex
+	value float64
+}
+
+func newGauge(name, help string) *gauge {
+	return &gauge{name: name, help: help}
+}
+
+func (g *gauge) set(v float64) {
+	g.mutex.Lock()
+	g.value = v
+	g.mutex.Unlock()
+}
+
+func (g *gauge) write(b *strings.Builder) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value))
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	name, help string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Observes the seconds since start.
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+func (h *histogram) write(b *strings.Builder) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", h.name, formatFloat(upper), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+// Formats the value the way Prometheus parses it.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return fmt.Sprint(v)
+}
+
+// countingReader counts the bytes read through it, and adds them to the
+// bytes read metric.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	metrics.bytesRead.add("", float64(n))
+	return n, err
+}
@@ -0,0 +1,114 @@
+package restTest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchMetrics(t *testing.T) {
+	handler := restTestHandler{status: http.StatusOK, totalCount: 25}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	var (
+		pages     = metrics.pagesFetched.get("")
+		ok        = metrics.responses.get("200")
+		notFound  = metrics.responses.get("404")
+		bytesRead = metrics.bytesRead.get("")
+		latency   = metrics.latency.count
+		fetchAll  = metrics.fetchAll.count
+	)
+
+	ch := make(chan []Transaction)
+	go fetchAllTransactions(ch, mockServer.URL+"/%d", 2)
+	for range ch {
+	}
+	if _, err := fetchPage(mockServer.URL + "/9"); err == nil {
+		t.Fatal("Expected fetching a page past the last one to fail")
+	}
+
+	tests := []struct {
+		name     string
+		actual   float64
+		expected float64
+	}{
+		{"pages fetched", metrics.pagesFetched.get("") - pages, 3},
+		{"200 responses", metrics.responses.get("200") - ok, 3},
+		{"404 responses", metrics.responses.get("404") - notFound, 1},
+		{"request latencies", float64(metrics.latency.count - latency), 4},
+		{"fetch all durations", float64(metrics.fetchAll.count - fetchAll), 1},
+	}
+	for _, tc := range tests {
+		if tc.actual != tc.expected {
+			t.Errorf("Expected %v %s, got %v", tc.expected, tc.name, tc.actual)
+		}
+	}
+	if n := metrics.bytesRead.get("") - bytesRead; n < float64(3*len(fmt.Sprintf(mockPageStr, 25, 1))) {
+		t.Errorf("Expected at least 3 pages worth of bytes read, got %v", n)
+	}
+}
+
+func TestAggregationMetrics(t *testing.T) {
+	processed := metrics.transactions.get("")
+
+	DailyBalancesFromTransactions(Slice([]Transaction{
+		{newDate("2013-12-01"), "", 100000, "DEPOSIT"},
+		{newDate("2013-12-02"), "Office Expense", -4253, "FEDEX"},
+	}))
+
+	if n := metrics.transactions.get("") - processed; n != 2 {
+		t.Errorf("Expected 2 transactions processed, got %v", n)
+	}
+	var b strings.Builder
+	metrics.totalBalance.write(&b)
+	if !strings.Contains(b.String(), "\nresttest_total_balance 957.47\n") {
+		t.Errorf("Expected total balance gauge 957.47, got:\n%s", b.String())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	c := newCounter("test_requests_total", "Requests.", "code")
+	c.add("500", 1)
+	c.add("200", 2)
+	h := newHistogram("test_duration_seconds", "Duration.", []float64{.1, 1})
+	h.observe(.05)
+	h.observe(.5)
+	h.observe(5)
+
+	var b strings.Builder
+	c.write(&b)
+	h.write(&b)
+	expected := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="500"} 1
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 5.55
+test_duration_seconds_count 3
+`
+	if b.String() != expected {
+		t.Errorf("Expected metrics:\n%s\nGot:\n%s", expected, b.String())
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the text exposition format content type, got %q", ct)
+	}
+	for _, name := range []string{
+		"resttest_pages_fetched_total", "resttest_http_responses_total", "resttest_fetch_errors_total",
+		"resttest_request_duration_seconds", "resttest_response_bytes_total", "resttest_fetch_all_duration_seconds",
+		"resttest_transactions_processed_total", "resttest_total_balance", "resttest_cache_requests_total",
+	} {
+		if !strings.Contains(rec.Body.String(), "# TYPE "+name+" ") {
+			t.Errorf("Expected metric %s to be served", name)
+		}
+	}
+}
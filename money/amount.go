@@ -10,7 +10,7 @@ import (
 )
 
 // Amount is a representation of money amounts in cents.
-// Ex. 10.50 is 1050 cents. Implements json.Unmarshaler.
+// Ex. 10.50 is 1050 cents. Implements json.Marshaler and json.Unmarshaler.
 type Amount int
 
 // UnmarshalJSON unmarshals byte slice into amount.
@@ -18,14 +18,30 @@ func (a *Amount) UnmarshalJSON(b []byte) error {
 	// remove quotation marks from string.
 	s := strings.Trim(string(b), "\"")
 
-	f, err := strconv.ParseFloat(s, 64)
+	amount, err := Parse(s)
 	if err != nil {
 		return err
 	}
-	*a = FromFloat(f)
+	*a = amount
 	return nil
 }
 
+// MarshalJSON marshals amount into a string in dollars and cents, the
+// format UnmarshalJSON reads.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + a.String() + `"`), nil
+}
+
+// Parse parses a decimal string (ex. -15.56) into an amount,
+// rounded to the nearest cent.
+func Parse(s string) (Amount, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return FromFloat(f), nil
+}
+
 // String returns amount as dollars and cents separated by a dot (ex. 15.56).
 func (a Amount) String() string {
 	dollars := a / 100
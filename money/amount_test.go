@@ -39,6 +39,32 @@ func TestAmountUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestAmountMarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    Amount
+		expected string
+	}{
+		{-11071, `"-110.71"`},
+		{-5, `"-0.05"`},
+		{10000, `"100.00"`},
+	}
+
+	for _, tc := range tests {
+		b, err := tc.input.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != tc.expected {
+			t.Errorf("Expected amount %s, Got %s", tc.expected, s)
+		}
+
+		var actual Amount
+		if err = actual.UnmarshalJSON(b); err != nil || actual != tc.input {
+			t.Errorf("Expected %s to unmarshal back into %d, Got %d (%v)", b, tc.input, actual, err)
+		}
+	}
+}
+
 func TestFromFloat(t *testing.T) {
 	tests := []struct {
 		in       float64
@@ -74,3 +100,29 @@ func TestString(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in         string
+		expected   Amount
+		shouldPass bool
+	}{
+		{"-117.81", Amount(-11781), true},
+		{"5518.17", Amount(551817), true},
+		{"0.005", Amount(1), true},
+		{"", Amount(0), false},
+		{"12,50", Amount(0), false},
+	}
+
+	for _, tc := range tests {
+		actual, err := Parse(tc.in)
+		if tc.shouldPass && err != nil {
+			t.Fatal(err)
+		} else if !tc.shouldPass && err == nil {
+			t.Fatalf("Expected %q test to fail, but it passed instead", tc.in)
+		}
+		if actual != tc.expected {
+			t.Errorf("Expected amount %d, got %d", tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package restTest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// Layout of the date part of OFX datetimes. Ex. 20131222120000.000[-5:EST].
+	ofxDateTemplate = "20060102"
+	// Layout of the OFX datetimes written by WriteOFX.
+	ofxTimeTemplate = "20060102150405"
+	// Maximum length of a STMTTRN NAME.
+	ofxNameLength = 32
+)
+
+// Statement is a bank statement read from an OFX or QFX file.
+type Statement struct {
+	// Statement transactions (STMTTRN entries) in the order they appear.
+	Transactions []Transaction
+	// Account balance the bank reports (LEDGERBAL) and the date it's as of.
+	LedgerBalance     money.Amount
+	LedgerBalanceDate Date
+}
+
+// OFXLedgerRule returns the ledger of an OFX transaction. It receives the
+// STMTTRN entry's elements keyed by tag name (ex. TRNTYPE, NAME, MEMO, SIC).
+type OFXLedgerRule func(fields map[string]string) string
+
+// LedgerByType returns an OFXLedgerRule that maps the transaction type
+// (TRNTYPE, ex. DEBIT, FEE, INT) to a ledger. Types missing from the map
+// get the ledger of the "" key, if any.
+func LedgerByType(ledgers map[string]string) OFXLedgerRule {
+	return func(fields map[string]string) string {
+		if l, ok := ledgers[fields["TRNTYPE"]]; ok {
+			return l
+		}
+		return ledgers[""]
+	}
+}
+
+// ParseLedgerTypes parses a comma separated list of TYPE=Ledger pairs, ex.
+// "DEBIT=Expenses,INT=Interest,*=Other", into the map LedgerByType takes.
+// The * type sets the ledger of the types that aren't listed.
+func ParseLedgerTypes(s string) (map[string]string, error) {
+	ledgers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		typ, ledger, ok := strings.Cut(pair, "=")
+		typ, ledger = strings.ToUpper(strings.TrimSpace(typ)), strings.TrimSpace(ledger)
+		if !ok || typ == "" || ledger == "" {
+			return nil, fmt.Errorf("invalid ledger mapping %q, expected TYPE=Ledger", pair)
+		}
+		if typ == "*" {
+			typ = ""
+		}
+		if _, dup := ledgers[typ]; dup {
+			return nil, fmt.Errorf("ledger mapping %q repeats a type", pair)
+		}
+		ledgers[typ] = ledger
+	}
+	return ledgers, nil
+}
+
+// Reconcile returns the difference between the bank's ledger balance and the
+// running balance calculated from the statement's transactions. The statement
+// only covers part of the account's history, so a constant difference is the
+// opening balance; a changing one means transactions are missing.
+func (s Statement) Reconcile(db DailyBalances) money.Amount {
+	if len(db.days) == 0 {
+		return s.LedgerBalance
+	}
+	return s.LedgerBalance - db.GetRunningBalance()
+}
+
+// ParseOFX parses an OFX 1.x (SGML) or 2.x (XML) bank statement. Each STMTTRN
+// entry becomes a transaction: DTPOSTED is its date, TRNAMT its amount and
+// NAME (or PAYEE) its company. The rule sets its ledger; if it's nil the
+// ledger is left empty.
+func ParseOFX(r io.Reader, rule OFXLedgerRule) (*Statement, error) {
+	var (
+		s = new(Statement)
+		// Elements of the aggregate being read; nil outside STMTTRN and LEDGERBAL.
+		fields map[string]string
+		// Tag of the last opened element whose value hasn't been read yet.
+		tag string
+	)
+
+	tokens := newOFXTokenizer(r)
+	for {
+		tok, isTag, err := tokens.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !isTag {
+			// Element value. SGML leaves elements unclosed so the value
+			// runs until the next tag.
+			if v := strings.TrimSpace(html.UnescapeString(tok)); fields != nil && tag != "" && v != "" {
+				fields[tag] = v
+			}
+			tag = ""
+			continue
+		}
+
+		tag = ""
+		switch name := strings.ToUpper(tok); name {
+		case "STMTTRN", "LEDGERBAL":
+			fields = map[string]string{}
+		case "/STMTTRN":
+			t, err := ofxTransaction(fields, rule)
+			if err != nil {
+				return nil, err
+			}
+			s.Transactions = append(s.Transactions, t)
+			fields = nil
+		case "/LEDGERBAL":
+			if s.LedgerBalance, err = parseOFXAmount(fields["BALAMT"]); err != nil {
+				return nil, fmt.Errorf("LEDGERBAL: %v", err)
+			}
+			if s.LedgerBalanceDate, err = parseOFXDate(fields["DTASOF"]); err != nil {
+				return nil, fmt.Errorf("LEDGERBAL: %v", err)
+			}
+			fields = nil
+		default:
+			if !strings.HasPrefix(name, "/") {
+				tag = name
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Converts a STMTTRN entry's elements into a transaction.
+func ofxTransaction(fields map[string]string, rule OFXLedgerRule) (t Transaction, err error) {
+	if t.Date, err = parseOFXDate(fields["DTPOSTED"]); err != nil {
+		return t, fmt.Errorf("STMTTRN %s: %v", fields["FITID"], err)
+	}
+	if t.Amount, err = parseOFXAmount(fields["TRNAMT"]); err != nil {
+		return t, fmt.Errorf("STMTTRN %s: %v", fields["FITID"], err)
+	}
+
+	t.Company = fields["NAME"]
+	if t.Company == "" {
+		t.Company = fields["PAYEE"]
+	}
+	if rule != nil {
+		t.Ledger = rule(fields)
+	}
+	return t, nil
+}
+
+// Parses the date part of an OFX datetime.
+func parseOFXDate(s string) (Date, error) {
+	if len(s) < len(ofxDateTemplate) {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+	t, err := time.Parse(ofxDateTemplate, s[:len(ofxDateTemplate)])
+	return Date{t}, err
+}
+
+// Parses an OFX amount, which may use a comma as its decimal separator.
+func parseOFXAmount(s string) (money.Amount, error) {
+	return money.Parse(strings.Replace(s, ",", ".", 1))
+}
+
+// Splits an OFX document into tags and the text between them. It skips the
+// SGML header, XML declaration, processing instructions and comments.
+type ofxTokenizer struct {
+	r *bufio.Reader
+}
+
+func newOFXTokenizer(r io.Reader) *ofxTokenizer {
+	return &ofxTokenizer{bufio.NewReader(r)}
+}
+
+// Returns the next tag name (without angle brackets) or text.
+func (t *ofxTokenizer) next() (tok string, isTag bool, err error) {
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return "", false, err
+		}
+
+		if b != '<' {
+			t.r.UnreadByte()
+			text, err := t.r.ReadString('<')
+			if err == nil {
+				t.r.UnreadByte()
+				text = text[:len(text)-1]
+			} else if err != io.EOF {
+				return "", false, err
+			}
+			return text, false, nil
+		}
+
+		tag, err := t.r.ReadString('>')
+		if err != nil {
+			return "", false, fmt.Errorf("unterminated tag <%s", tag)
+		}
+		tag = strings.TrimSpace(tag[:len(tag)-1])
+
+		// Skip <?xml ...?>, <?OFX ...?> and <!-- ... -->
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+		// Drop attributes and the self closing slash
+		if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 {
+			tag = tag[:i]
+		}
+		return strings.TrimSuffix(tag, "/"), true, nil
+	}
+}
+
+// OFXFile is a Source that reads the transactions of an OFX or QFX bank
+// statement. Once its channel is closed, Statement holds the parsed
+// statement, including the bank's ledger balance.
+type OFXFile struct {
+	reader
+	Path string
+	// Sets each transaction's ledger. Optional.
+	Ledger    OFXLedgerRule
+	Statement *Statement
+}
+
+// Transactions implements Source.
+func (o *OFXFile) Transactions() chan []Transaction {
+	return o.start(func(ch chan []Transaction) error {
+		f, err := os.Open(o.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		s, err := ParseOFX(f, o.Ledger)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.Path, err)
+		}
+		o.Statement = s
+		sendBatches(ch, s.Transactions)
+		return nil
+	})
+}
+
+// OFXOptions configures the statement written by WriteOFX.
+type OFXOptions struct {
+	// Bank routing number and account number. Default to 0.
+	BankID    string
+	AccountID string
+	// Account type. Ex. CHECKING, SAVINGS, CREDITLINE. Defaults to CHECKING.
+	AccountType string
+	// Currency of the amounts. Defaults to CAD.
+	Currency string
+	// Time the statement is generated at. Defaults to now.
+	Generated time.Time
+}
+
+// FITID returns a financial institution transaction ID for the transaction.
+// It's a hash of the transaction's fields and position, the number of
+// identical transactions before it, so it stays the same when the same
+// transactions are exported again, in any order, and importers can use it
+// to skip transactions they've already seen.
+func FITID(t Transaction, position int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%d",
+		t.Date.Format(dateTemplate), t.Amount, t.Company, t.Ledger, position)))
+	return fmt.Sprintf("%x", sum[:10])
+}
+
+// WriteOFX writes the transactions as an OFX 2.x bank statement. Each one
+// becomes a STMTTRN entry with the transaction's ledger as its MEMO, and the
+// statement's LEDGERBAL is the transactions' running balance. The entries are
+// sorted by date, company, amount and ledger, so the statement doesn't depend
+// on the order the transactions were fetched in.
+func WriteOFX(w io.Writer, ts []Transaction, opts OFXOptions) error {
+	if opts.BankID == "" {
+		opts.BankID = "0"
+	}
+	if opts.AccountID == "" {
+		opts.AccountID = "0"
+	}
+	if opts.AccountType == "" {
+		opts.AccountType = "CHECKING"
+	}
+	if opts.Currency == "" {
+		opts.Currency = "CAD"
+	}
+	if opts.Generated.IsZero() {
+		opts.Generated = time.Now()
+	}
+
+	// Statement period and closing balance
+	var (
+		start, end = opts.Generated, opts.Generated
+		balance    money.Amount
+	)
+	if len(ts) > 0 {
+		db := DailyBalancesFromTransactions(Slice(ts))
+		start, end = db.days[0].Time, db.days[len(db.days)-1].Time
+		balance = db.GetRunningBalance()
+	}
+
+	bw := bufio.NewWriter(w)
+	// Writes an element with its value escaped
+	element := func(tag, value string) {
+		fmt.Fprintf(bw, "<%s>", tag)
+		xml.EscapeText(bw, []byte(value))
+		fmt.Fprintf(bw, "</%s>\n", tag)
+	}
+
+	fmt.Fprint(bw, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1><SONRS>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+`)
+	element("DTSERVER", opts.Generated.Format(ofxTimeTemplate))
+	fmt.Fprint(bw, `<LANGUAGE>ENG</LANGUAGE>
+</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS>
+<TRNUID>0</TRNUID>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS>
+`)
+	element("CURDEF", opts.Currency)
+	fmt.Fprint(bw, "<BANKACCTFROM>\n")
+	element("BANKID", opts.BankID)
+	element("ACCTID", opts.AccountID)
+	element("ACCTTYPE", opts.AccountType)
+	fmt.Fprint(bw, "</BANKACCTFROM>\n<BANKTRANLIST>\n")
+	element("DTSTART", start.Format(ofxDateTemplate))
+	element("DTEND", end.Format(ofxDateTemplate))
+
+	// Number of identical transactions written so far
+	seen := make(map[string]int)
+	for _, t := range ofxEntries(ts) {
+		trnType := "DEBIT"
+		if t.Amount > 0 {
+			trnType = "CREDIT"
+		}
+		name := t.Company
+		if r := []rune(name); len(r) > ofxNameLength {
+			name = string(r[:ofxNameLength])
+		}
+
+		fmt.Fprint(bw, "<STMTTRN>\n")
+		element("TRNTYPE", trnType)
+		element("DTPOSTED", t.Date.Format(ofxDateTemplate))
+		element("TRNAMT", t.Amount.String())
+		key := FITID(t, 0)
+		element("FITID", FITID(t, seen[key]))
+		seen[key]++
+		element("NAME", name)
+		if t.Ledger != "" {
+			element("MEMO", t.Ledger)
+		}
+		fmt.Fprint(bw, "</STMTTRN>\n")
+	}
+
+	fmt.Fprint(bw, "</BANKTRANLIST>\n<LEDGERBAL>\n")
+	element("BALAMT", balance.String())
+	element("DTASOF", end.Format(ofxDateTemplate))
+	fmt.Fprint(bw, `</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`)
+	return bw.Flush()
+}
+
+// Returns a copy of the transactions sorted by date, then company, amount
+// and ledger.
+func ofxEntries(ts []Transaction) []Transaction {
+	sorted := make([]Transaction, len(ts))
+	copy(sorted, ts)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case !a.Date.Equal(b.Date.Time):
+			return a.Date.Before(b.Date.Time)
+		case a.Company != b.Company:
+			return a.Company < b.Company
+		case a.Amount != b.Amount:
+			return a.Amount < b.Amount
+		}
+		return a.Ledger < b.Ledger
+	})
+	return sorted
+}
@@ -0,0 +1,261 @@
+package restTest
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>CAD
+<BANKTRANLIST>
+<DTSTART>20131201
+<DTEND>20131231
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20131222120000.000[-8:PST]
+<TRNAMT>-110.71
+<FITID>1
+<NAME>SHAW CABLESYSTEMS CALGARY AB
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20131223
+<TRNAMT>1000,00
+<FITID>2
+<NAME>PAYROLL &amp; CO
+<MEMO>Deposit
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>2889.29
+<DTASOF>20131231
+</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+	ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE"?>
+<OFX>
+	<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+		<BANKTRANLIST>
+			<STMTTRN>
+				<TRNTYPE>FEE</TRNTYPE>
+				<DTPOSTED>20131222</DTPOSTED>
+				<TRNAMT>-5.00</TRNAMT>
+				<FITID>1</FITID>
+				<PAYEE><NAME>BANK FEE</NAME></PAYEE>
+			</STMTTRN>
+		</BANKTRANLIST>
+		<LEDGERBAL><BALAMT>-5.00</BALAMT><DTASOF>20131231</DTASOF></LEDGERBAL>
+	</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+)
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		input         string
+		transactions  []Transaction
+		ledgerBalance money.Amount
+	}{
+		{
+			ofxSGML,
+			[]Transaction{
+				{newDate("2013-12-22"), "Expense", -11071, "SHAW CABLESYSTEMS CALGARY AB"},
+				{newDate("2013-12-23"), "Income", 100000, "PAYROLL & CO"},
+			},
+			money.Amount(288929),
+		},
+		{
+			ofxXML,
+			[]Transaction{{newDate("2013-12-22"), "Bank Fees", -500, "BANK FEE"}},
+			money.Amount(-500),
+		},
+	}
+
+	rule := LedgerByType(map[string]string{"CREDIT": "Income", "FEE": "Bank Fees", "": "Expense"})
+	for _, tc := range tests {
+		s, err := ParseOFX(strings.NewReader(tc.input), rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(s.Transactions) != len(tc.transactions) {
+			t.Fatalf("Expected %d transactions, got %d", len(tc.transactions), len(s.Transactions))
+		}
+		for i, e := range tc.transactions {
+			if a := s.Transactions[i]; a.String() != e.String() {
+				t.Errorf("Expected transaction %v\nGot %v", e, a)
+			}
+		}
+		if s.LedgerBalance != tc.ledgerBalance {
+			t.Errorf("Expected ledger balance %s, got %s", tc.ledgerBalance, s.LedgerBalance)
+		}
+		if d := s.LedgerBalanceDate.Format(dateTemplate); d != "2013-12-31" {
+			t.Errorf("Expected ledger balance date %s, got %s", "2013-12-31", d)
+		}
+	}
+}
+
+func TestParseOFXInvalid(t *testing.T) {
+	tests := []string{
+		"<OFX><STMTTRN><DTPOSTED>2013<TRNAMT>1.00</STMTTRN></OFX>",
+		"<OFX><STMTTRN><DTPOSTED>20131222<TRNAMT>abc</STMTTRN></OFX>",
+		"<OFX><LEDGERBAL><BALAMT>1.00</LEDGERBAL></OFX>",
+		"<OFX><STMTTRN",
+	}
+
+	for _, input := range tests {
+		if _, err := ParseOFX(strings.NewReader(input), nil); err == nil {
+			t.Errorf("Expected parsing %q to fail", input)
+		}
+	}
+}
+
+func TestParseLedgerTypes(t *testing.T) {
+	ledgers, err := ParseLedgerTypes("debit=Office Expense, INT=Interest,*=Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"DEBIT": "Office Expense", "INT": "Interest", "": "Other"}
+	if !reflect.DeepEqual(ledgers, expected) {
+		t.Errorf("Expected %v, got %v", expected, ledgers)
+	}
+
+	s, err := ParseOFX(strings.NewReader(ofxSGML), LedgerByType(ledgers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range []string{"Office Expense", "Other"} {
+		if l := s.Transactions[i].Ledger; l != e {
+			t.Errorf("Expected transaction %d's ledger %q, got %q", i, e, l)
+		}
+	}
+
+	for _, input := range []string{"", "DEBIT", "DEBIT=", "=Other", "DEBIT=A,debit=B"} {
+		if _, err := ParseLedgerTypes(input); err == nil {
+			t.Errorf("Expected parsing %q to fail", input)
+		}
+	}
+}
+
+func TestStatementReconcile(t *testing.T) {
+	s, err := ParseOFX(strings.NewReader(ofxSGML), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := DailyBalancesFromTransactions(&OFXFile{Path: writeTemp(t, "statement.ofx", ofxSGML)})
+
+	// Opening balance is the ledger balance minus the statement's net change
+	if expected, actual := money.Amount(288929-88929), s.Reconcile(db); expected != actual {
+		t.Errorf("Expected reconciliation difference %s, got %s", expected, actual)
+	}
+}
+
+func TestWriteOFX(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-22"), "Phone & Internet Expense", -11071, "SHAW CABLESYSTEMS CALGARY AB"},
+		{newDate("2013-12-23"), "", 100000, "A VERY LONG COMPANY NAME THAT DOESN'T FIT"},
+	}
+	opts := OFXOptions{Generated: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var b1, b2 bytes.Buffer
+	if err := WriteOFX(&b1, ts, opts); err != nil {
+		t.Fatal(err)
+	}
+	WriteOFX(&b2, ts, opts)
+	if b1.String() != b2.String() {
+		t.Error("Expected exporting the same transactions twice to produce the same file")
+	}
+
+	// Read it back, using the memo as the ledger
+	s, err := ParseOFX(&b1, func(fields map[string]string) string { return fields["MEMO"] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Transactions) != len(ts) {
+		t.Fatalf("Expected %d transactions, got %d", len(ts), len(s.Transactions))
+	}
+	if e, a := ts[0], s.Transactions[0]; a.String() != e.String() {
+		t.Errorf("Expected transaction %v\nGot %v", e, a)
+	}
+	if c := s.Transactions[1].Company; c != "A VERY LONG COMPANY NAME THAT DO" {
+		t.Errorf("Expected company to be truncated to %d characters, got %q", ofxNameLength, c)
+	}
+	if expected := money.Amount(88929); s.LedgerBalance != expected {
+		t.Errorf("Expected ledger balance %s, got %s", expected, s.LedgerBalance)
+	}
+	if d := s.LedgerBalanceDate.Format(dateTemplate); d != "2013-12-23" {
+		t.Errorf("Expected ledger balance date %s, got %s", "2013-12-23", d)
+	}
+}
+
+func TestFITID(t *testing.T) {
+	tr := Transaction{newDate("2013-12-22"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"}
+
+	if FITID(tr, 0) != FITID(tr, 0) {
+		t.Error("Expected FITID to be stable")
+	}
+	// Identical transactions on the same day must still differ
+	if FITID(tr, 0) == FITID(tr, 1) {
+		t.Error("Expected FITID to depend on the transaction's position")
+	}
+	other := tr
+	other.Amount = -4254
+	if FITID(tr, 0) == FITID(other, 0) {
+		t.Error("Expected FITID to depend on the transaction's amount")
+	}
+}
+
+func TestWriteOFXOrder(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-22"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		{newDate("2013-12-22"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		{newDate("2013-12-21"), "Insurance Expense", -11700, "LONDON DRUGS 78 POSTAL VANCOUVER BC"},
+		{newDate("2013-12-22"), "", 100000, "PAYMENT"},
+		{newDate("2013-12-20"), "Office Expense", -2500, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+	}
+	opts := OFXOptions{Generated: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fitids := regexp.MustCompile(`<FITID>[^<]*</FITID>`)
+
+	var expected bytes.Buffer
+	if err := WriteOFX(&expected, ts, opts); err != nil {
+		t.Fatal(err)
+	}
+	if ids := fitids.FindAllString(expected.String(), -1); len(ids) != len(ts) || ids[0] == ids[1] {
+		t.Fatalf("Expected %d FITIDs, different for identical transactions, got %v", len(ts), ids)
+	}
+
+	// Pages fetched concurrently arrive in any order
+	for i := 0; i < 10; i++ {
+		shuffled := make([]Transaction, len(ts))
+		copy(shuffled, ts)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+		var actual bytes.Buffer
+		WriteOFX(&actual, shuffled, opts)
+		if e, a := fitids.FindAllString(expected.String(), -1), fitids.FindAllString(actual.String(), -1); !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected FITIDs %v for %v, got %v", e, shuffled, a)
+		}
+		if actual.String() != expected.String() {
+			t.Errorf("Expected the same statement for %v\n%s\ngot\n%s", shuffled, &expected, &actual)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package restTest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress, if set, is called after each page is fetched. Calls are never
+// concurrent, so it may render the progress without locking.
+var Progress func(FetchProgress)
+
+// FetchProgress reports how far fetching all pages has got.
+type FetchProgress struct {
+	// Pages fetched so far, and the total number of pages to fetch,
+	// which is known once the first page is fetched.
+	Pages, TotalPages int
+	// Bytes of page responses read so far.
+	Bytes int64
+	// Time since fetching started.
+	Elapsed time.Duration
+	// Estimated time left at the average rate so far.
+	ETA time.Duration
+}
+
+// Done reports whether all pages are fetched.
+func (p FetchProgress) Done() bool {
+	return p.Pages >= p.TotalPages
+}
+
+// Returns the progress formatted as a line. Ex.
+// 120/300 pages (40%), 1.2 MB, ETA 12s
+func (p FetchProgress) String() string {
+	s := fmt.Sprintf("%d/%d pages (%.0f%%), %s", p.Pages, p.TotalPages, p.fraction()*100, formatBytes(p.Bytes))
+	if p.Done() {
+		return s + ", took " + p.Elapsed.Round(time.Millisecond).String()
+	}
+	return s + ", ETA " + p.ETA.Round(time.Second).String()
+}
+
+// Fraction of the pages fetched, from 0 to 1.
+func (p FetchProgress) fraction() float64 {
+	if p.TotalPages == 0 {
+		return 0
+	}
+	return float64(p.Pages) / float64(p.TotalPages)
+}
+
+// ProgressBar returns a progress bar followed by the progress, at most width
+// columns wide. Ex.
+// [=========>           ] 120/300 pages (40%), 1.2 MB, ETA 12s
+func ProgressBar(p FetchProgress, width int) string {
+	s := p.String()
+	// The brackets and space around the bar
+	barWidth := width - len(s) - 3
+	if barWidth < 10 {
+		return s
+	}
+
+	filled := int(p.fraction() * float64(barWidth))
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	return "[" + bar + "] " + s
+}
+
+// Returns the byte count in B, kB or MB.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// progressTracker counts the pages fetched and reports them to Progress.
+type progressTracker struct {
+	mutex sync.Mutex
+	start time.Time
+	p     FetchProgress
+}
+
+func newProgressTracker(start time.Time) *progressTracker {
+	return &progressTracker{start: start}
+}
+
+// Sets the total number of pages to fetch.
+func (t *progressTracker) setTotal(pages int) {
+	t.mutex.Lock()
+	t.p.TotalPages = pages
+	t.mutex.Unlock()
+}
+
+// Counts a fetched page of n bytes and reports the progress.
+func (t *progressTracker) add(n int64) {
+	if Progress == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.p.Pages++
+	t.p.Bytes += n
+	t.p.Elapsed = time.Since(t.start)
+	t.p.ETA = 0
+	if t.p.Pages < t.p.TotalPages {
+		t.p.ETA = t.p.Elapsed / time.Duration(t.p.Pages) * time.Duration(t.p.TotalPages-t.p.Pages)
+	}
+	Progress(t.p)
+}
@@ -0,0 +1,71 @@
+package restTest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchProgress(t *testing.T) {
+	handler := restTestHandler{status: http.StatusOK, totalCount: 45}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	var updates []FetchProgress
+	defer func() { Progress = nil }()
+	Progress = func(p FetchProgress) { updates = append(updates, p) }
+
+	ch := make(chan []Transaction)
+	go fetchAllTransactions(ch, mockServer.URL+"/%d", 3)
+	for range ch {
+	}
+
+	if len(updates) != 5 {
+		t.Fatalf("Expected an update for each of the 5 pages, got %d", len(updates))
+	}
+	for i, p := range updates {
+		if p.Pages != i+1 || p.TotalPages != 5 {
+			t.Errorf("Expected %d/5 pages, got %d/%d", i+1, p.Pages, p.TotalPages)
+		}
+		if i > 0 && (p.Bytes <= updates[i-1].Bytes || p.Elapsed < updates[i-1].Elapsed) {
+			t.Errorf("Expected bytes and elapsed time to grow, got %+v after %+v", p, updates[i-1])
+		}
+		if p.Done() != (i == 4) {
+			t.Errorf("Expected only the last update to be done, got %+v", p)
+		}
+	}
+	if eta := updates[4].ETA; eta != 0 {
+		t.Errorf("Expected no time left when done, got %s", eta)
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		p        FetchProgress
+		width    int
+		expected string
+	}{
+		{
+			FetchProgress{Pages: 120, TotalPages: 300, Bytes: 1234567, ETA: 12400 * time.Millisecond},
+			60,
+			"[========>            ] 120/300 pages (40%), 1.2 MB, ETA 12s",
+		},
+		{
+			FetchProgress{Pages: 3, TotalPages: 3, Bytes: 2500, Elapsed: 1500 * time.Millisecond},
+			60,
+			"[======================] 3/3 pages (100%), 2.5 kB, took 1.5s",
+		},
+		// Too narrow for a bar
+		{
+			FetchProgress{Pages: 1, TotalPages: 3, Bytes: 900, ETA: 2 * time.Second},
+			30,
+			"1/3 pages (33%), 900 B, ETA 2s",
+		},
+	}
+	for _, tc := range tests {
+		if s := ProgressBar(tc.p, tc.width); s != tc.expected {
+			t.Errorf("Expected progress bar\n%q\nGot\n%q", tc.expected, s)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package restTest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Date layouts tried, in order, when a QIF file's date layout isn't given.
+// QIF has no standard date format; these are the ones banks commonly export.
+var qifDateTemplates = []string{
+	"01/02/2006",
+	"1/2/2006",
+	"01/02'06",
+	"1/2'06",
+	"01/02/06",
+	"1/2/06",
+	dateTemplate,
+}
+
+// ParseQIF parses the transactions of a QIF (Quicken Interchange Format) file.
+// Each record becomes a transaction: D is its date, T (or U) its amount, P its
+// company and L, the category, its ledger. Records of non-transaction sections
+// (ex. !Type:Cat) are skipped.
+//
+// dateLayout is the layout of the D lines as accepted by time.Parse. If it's
+// empty, the common QIF layouts are tried in turn (month before day).
+func ParseQIF(r io.Reader, dateLayout string) ([]Transaction, error) {
+	var (
+		ts []Transaction
+		t  Transaction
+		// Whether the current section holds transactions
+		inTransactions = true
+		// Whether the current record has a date and amount
+		hasDate, hasAmount bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		code, value := line[0], strings.TrimSpace(line[1:])
+
+		if code == '!' {
+			// Section header. Ex. !Type:Bank or !Account
+			kind := strings.ToLower(value)
+			inTransactions = strings.HasPrefix(kind, "type:") &&
+				kind != "type:cat" && kind != "type:class" && kind != "type:memorized"
+			continue
+		}
+		if !inTransactions {
+			continue
+		}
+
+		var err error
+		switch code {
+		case 'D':
+			t.Date, err = parseQIFDate(value, dateLayout)
+			hasDate = true
+		case 'T', 'U':
+			t.Amount, err = money.Parse(strings.Replace(value, ",", "", -1))
+			hasAmount = true
+		case 'P':
+			t.Company = value
+		case 'L':
+			t.Ledger = value
+		case '^':
+			// End of record
+			if !hasDate || !hasAmount {
+				return nil, fmt.Errorf("line %d: record missing date or amount", n)
+			}
+			ts = append(ts, t)
+			t, hasDate, hasAmount = Transaction{}, false, false
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The last record may be missing its end marker
+	if hasDate && hasAmount {
+		ts = append(ts, t)
+	}
+
+	return ts, nil
+}
+
+// Parses a QIF date with the layout, or with the first common layout that matches.
+func parseQIFDate(s, layout string) (Date, error) {
+	if layout != "" {
+		t, err := time.Parse(layout, s)
+		return Date{t}, err
+	}
+
+	// Some exports pad the day or the year with spaces. Ex. 12/ 2' 4
+	s = strings.Replace(s, " ", "0", -1)
+	for _, layout := range qifDateTemplates {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Date{t}, nil
+		}
+	}
+	return Date{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// QIFFile is a Source that reads the transactions of a QIF file.
+type QIFFile struct {
+	reader
+	Path string
+	// Layout of the file's dates. Optional. See ParseQIF.
+	DateLayout string
+}
+
+// Transactions implements Source.
+func (q *QIFFile) Transactions() chan []Transaction {
+	return q.start(func(ch chan []Transaction) error {
+		f, err := os.Open(q.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		ts, err := ParseQIF(f, q.DateLayout)
+		if err != nil {
+			return fmt.Errorf("%s: %v", q.Path, err)
+		}
+		sendBatches(ch, ts)
+		return nil
+	})
+}
+
+// WriteQIF writes the transactions as a QIF bank account (!Type:Bank).
+// Dates use the month first layout 01/02/2006 and each transaction's
+// ledger is its category.
+func WriteQIF(w io.Writer, ts []Transaction) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "!Type:Bank")
+	for _, t := range ts {
+		fmt.Fprintf(bw, "D%s\nT%s\n", t.Date.Format(qifDateTemplates[0]), t.Amount)
+		if t.Company != "" {
+			fmt.Fprintf(bw, "P%s\n", t.Company)
+		}
+		if t.Ledger != "" {
+			fmt.Fprintf(bw, "L%s\n", t.Ledger)
+		}
+		fmt.Fprintln(bw, "^")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,90 @@
+package restTest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseQIF(t *testing.T) {
+	input := `!Type:Cat
+NOffice Expense
+^
+!Type:Bank
+D12/22/2013
+T-1,110.71
+PSHAW CABLESYSTEMS CALGARY AB
+LPhone & Internet Expense
+^
+D12/ 3' 4
+U500.00
+PPAYROLL
+`
+	ts, err := ParseQIF(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Transaction{
+		{newDate("2013-12-22"), "Phone & Internet Expense", -111071, "SHAW CABLESYSTEMS CALGARY AB"},
+		{newDate("2004-12-03"), "", 50000, "PAYROLL"},
+	}
+	if len(ts) != len(expected) {
+		t.Fatalf("Expected %d transactions, got %d", len(expected), len(ts))
+	}
+	for i, e := range expected {
+		if a := ts[i]; a.String() != e.String() {
+			t.Errorf("Expected transaction %v\nGot %v", e, a)
+		}
+	}
+
+	// Explicit layout for day first dates
+	ts, err = ParseQIF(strings.NewReader("!Type:Bank\nD22.12.2013\nT-1.00\n^\n"), "02.01.2006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ts[0].Date.Format(dateTemplate); d != "2013-12-22" {
+		t.Errorf("Expected date %s, got %s", "2013-12-22", d)
+	}
+}
+
+func TestParseQIFInvalid(t *testing.T) {
+	tests := []string{
+		"!Type:Bank\nD13/45/2013\nT1.00\n^\n",
+		"!Type:Bank\nD12/22/2013\nTabc\n^\n",
+		"!Type:Bank\nPNO DATE\nT1.00\n^\n",
+	}
+
+	for _, input := range tests {
+		if _, err := ParseQIF(strings.NewReader(input), ""); err == nil {
+			t.Errorf("Expected parsing %q to fail", input)
+		}
+	}
+}
+
+func TestWriteQIF(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-22"), "Phone & Internet Expense", -11071, "SHAW CABLESYSTEMS CALGARY AB"},
+		{newDate("2013-12-23"), "", 100000, ""},
+	}
+
+	var b bytes.Buffer
+	if err := WriteQIF(&b, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "!Type:Bank\nD12/22/2013\nT-110.71\nPSHAW CABLESYSTEMS CALGARY AB\nLPhone & Internet Expense\n^\nD12/23/2013\nT1000.00\n^\n"
+	if actual := b.String(); actual != expected {
+		t.Errorf("Expected QIF:\n%s\nGot:\n%s", expected, actual)
+	}
+
+	parsed, err := ParseQIF(&b, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range ts {
+		if a := parsed[i]; a.String() != e.String() {
+			t.Errorf("Expected transaction %v\nGot %v", e, a)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package restTest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// recordedResponse is the on-disk representation of an HTTP response.
+type recordedResponse struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Status     string      `json:"status"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Returns the request's response as a recordedResponse. The body is read in
+// full, and replaced with a reader over the same bytes so it can still be read.
+func recordResponse(req *http.Request, res *http.Response) (recordedResponse, error) {
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return recordedResponse{}, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	return recordedResponse{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Status:     res.Status,
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       string(body),
+	}, nil
+}
+
+// Recorder is an http.RoundTripper that saves every response it receives,
+// with its status and headers, to a file in Dir.
+type Recorder struct {
+	// Directory the responses are written to. It must already exist.
+	Dir string
+	// Transport used to make the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Replayer is an http.RoundTripper that serves responses previously saved
+// by a Recorder instead of making requests.
+// Returns ReplayError if a request has no recorded response.
+type Replayer struct {
+	// Directory the responses are read from.
+	Dir string
+}
+
+// Returns the file name of a request's recorded response. It's derived from
+// the method and URL so that the same request always maps to the same file.
+func recordingPath(dir string, req *http.Request) string {
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+	return filepath.Join(dir, fmt.Sprintf("%x.json", sum))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := recordResponse(req, res)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(rec, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(recordingPath(r.Dir, req), b, 0644); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := os.ReadFile(recordingPath(r.Dir, req))
+	if os.IsNotExist(err) {
+		return nil, ReplayError{req.Method, req.URL.String()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	rec := new(recordedResponse)
+	if err = json.Unmarshal(b, rec); err != nil {
+		return nil, err
+	}
+
+	// Guard against hash collisions and hand-edited recordings
+	if rec.Method != req.Method || rec.URL != req.URL.String() {
+		return nil, ReplayError{req.Method, req.URL.String()}
+	}
+
+	return rec.response(req), nil
+}
+
+// Returns the recorded response as a response to the request.
+func (rec *recordedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        rec.Status,
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(rec.Body))),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}
+}
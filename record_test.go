@@ -0,0 +1,67 @@
+package restTest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// Record a page from the mock server
+	handler := restTestHandler{http.StatusOK, 10, nil}
+	mockServer := httptest.NewServer(&handler)
+	url := pageURL(1, mockServer.URL+"/%d")
+
+	Client = &http.Client{Transport: Recorder{Dir: dir}}
+	defer func() { Client = &http.Client{} }()
+
+	recorded, err := fetchPage(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("Expected 1 recorded response, got %d", len(files))
+	}
+
+	// Replay it after the server is gone
+	mockServer.Close()
+	Client = &http.Client{Transport: Replayer{Dir: dir}}
+
+	replayed, err := fetchPage(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := recorded.String(), replayed.String(); expected != actual {
+		t.Errorf("Expected replayed page %s\nGot %s", expected, actual)
+	}
+
+	// Requests that weren't recorded must fail
+	_, err = fetchPage(pageURL(2, mockServer.URL+"/%d"))
+	if err == nil {
+		t.Fatal("Expected replaying an unrecorded request to fail")
+	}
+}
+
+func TestRecordNonOKStatus(t *testing.T) {
+	dir := t.TempDir()
+
+	handler := restTestHandler{http.StatusNotFound, 0, nil}
+	mockServer := httptest.NewServer(&handler)
+	url := pageURL(1, mockServer.URL+"/%d")
+
+	Client = &http.Client{Transport: Recorder{Dir: dir}}
+	defer func() { Client = &http.Client{} }()
+
+	fetchPage(url)
+	mockServer.Close()
+
+	Client = &http.Client{Transport: Replayer{Dir: dir}}
+	_, err := fetchPage(url)
+	if e, ok := err.(HTTPError); !ok || e.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected replayed HTTPError with status %d, got %v", http.StatusNotFound, err)
+	}
+}
@@ -0,0 +1,257 @@
+package restTest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// Amounts within this fraction of a series' first amount belong to the same series.
+	recurringAmountTolerance = 0.2
+	// Fraction of a series' intervals that must match its cadence.
+	recurringIntervalShare = 0.75
+	// Minimum number of transactions of a weekly or monthly series.
+	minRecurringCount = 3
+)
+
+// Cadence is the interval at which a recurring transaction repeats.
+type Cadence int
+
+// Cadences a recurring series can have.
+const (
+	Weekly Cadence = iota + 1
+	Monthly
+	Yearly
+)
+
+// Returns the cadence's name.
+func (c Cadence) String() string {
+	switch c {
+	case Weekly:
+		return "weekly"
+	case Monthly:
+		return "monthly"
+	case Yearly:
+		return "yearly"
+	}
+	return "unknown"
+}
+
+// Returns the range of days between two transactions of the cadence.
+func (c Cadence) interval() (min, max int) {
+	switch c {
+	case Weekly:
+		return 6, 8
+	case Monthly:
+		return 27, 33
+	}
+	return 350, 380
+}
+
+// Returns the number of days a transaction may be late before it's missed.
+func (c Cadence) grace() int {
+	switch c {
+	case Weekly:
+		return 3
+	case Monthly:
+		return 7
+	}
+	return 30
+}
+
+// Next returns the date a transaction of the cadence is expected after d.
+func (c Cadence) Next(d Date) Date {
+	switch c {
+	case Weekly:
+		return Date{d.AddDate(0, 0, 7)}
+	case Monthly:
+		return Date{d.AddDate(0, 1, 0)}
+	}
+	return Date{d.AddDate(1, 0, 0)}
+}
+
+// RecurringStatus tells whether a recurring series is still going.
+type RecurringStatus string
+
+// Statuses of a recurring series as of the last date in the data.
+const (
+	// The next transaction isn't due yet, or is due within the grace period.
+	Active RecurringStatus = "active"
+	// The next transaction is overdue.
+	Missed RecurringStatus = "missed"
+	// More than one transaction is overdue; the series appears cancelled.
+	Cancelled RecurringStatus = "cancelled"
+)
+
+// Recurring is a series of transactions from the same merchant with similar
+// amounts at a regular interval.
+type Recurring struct {
+	// Normalized company name.
+	Merchant string
+	Cadence  Cadence
+	// Average amount of the series' transactions.
+	Average money.Amount
+	// Date of the last transaction and the date the next one is expected.
+	Last Date
+	Next Date
+	// Status as of the date the series was detected at.
+	Status RecurringStatus
+	// The series' transactions sorted by date.
+	Transactions []Transaction
+}
+
+// Returns the recurring series' fields formatted as a table row.
+func (r Recurring) String() string {
+	return fmt.Sprintf("%-30s %-8s %12s %6d  %s  %s  %s",
+		r.Merchant, r.Cadence, r.Average, len(r.Transactions),
+		r.Last.Format(dateTemplate), r.Next.Format(dateTemplate), r.Status)
+}
+
+// RecurringSeries is a list of detected recurring series.
+type RecurringSeries []Recurring
+
+// Returns the series formatted as a table.
+func (rs RecurringSeries) String() string {
+	s := []string{fmt.Sprintf("%-30s %-8s %12s %6s  %-10s  %-10s  %s",
+		"Merchant", "Cadence", "Average", "Count", "Last", "Next", "Status")}
+	for _, r := range rs {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// DetectRecurring finds series of transactions from the same merchant, as
+// normalized by n, with amounts within 20% of each other at a weekly, monthly
+// or yearly interval. Weekly and monthly series need at least 3 transactions
+// and yearly ones 2. Series are missed or cancelled if their next transaction
+// is overdue as of asOf; if asOf is the zero date, the last transaction's date
+// is used. The series are sorted by merchant.
+func DetectRecurring(ts []Transaction, n *Normalizer, asOf Date) RecurringSeries {
+	// Group transactions by merchant
+	merchants := make(map[string][]Transaction)
+	for _, t := range ts {
+		name := n.Normalize(t.Company)
+		merchants[name] = append(merchants[name], t)
+	}
+
+	// Default to the last transaction's date
+	if asOf.IsZero() {
+		for _, t := range ts {
+			if t.Date.After(asOf.Time) {
+				asOf = t.Date
+			}
+		}
+	}
+
+	var series RecurringSeries
+	for name, group := range merchants {
+		for _, cluster := range clusterAmounts(group) {
+			if r, ok := detectCadence(cluster); ok {
+				r.Merchant = name
+				r.Status = r.status(asOf)
+				series = append(series, r)
+			}
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Merchant != series[j].Merchant {
+			return series[i].Merchant < series[j].Merchant
+		}
+		return series[i].Average < series[j].Average
+	})
+	return series
+}
+
+// Splits the transactions into groups with similar amounts. Each group holds
+// the amounts of the same sign within recurringAmountTolerance of its smallest
+// (in magnitude), so refunds aren't grouped with the charges they refund.
+func clusterAmounts(ts []Transaction) [][]Transaction {
+	sorted := make([]Transaction, len(ts))
+	copy(sorted, ts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if a, b := sorted[i].Amount < 0, sorted[j].Amount < 0; a != b {
+			return a
+		}
+		return abs(sorted[i].Amount) < abs(sorted[j].Amount)
+	})
+
+	var clusters [][]Transaction
+	for i := 0; i < len(sorted); {
+		first, debit := abs(sorted[i].Amount), sorted[i].Amount < 0
+		j := i + 1
+		for j < len(sorted) && sorted[j].Amount < 0 == debit &&
+			float64(abs(sorted[j].Amount)-first) <= recurringAmountTolerance*float64(first) {
+			j++
+		}
+		clusters = append(clusters, sorted[i:j])
+		i = j
+	}
+	return clusters
+}
+
+// Returns the recurring series of the transactions if they repeat at one of
+// the cadences.
+func detectCadence(ts []Transaction) (Recurring, bool) {
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Date.Before(ts[j].Date.Time) })
+
+	for _, c := range []Cadence{Weekly, Monthly, Yearly} {
+		min := minRecurringCount
+		if c == Yearly {
+			min = 2
+		}
+		if len(ts) < min {
+			continue
+		}
+
+		lo, hi := c.interval()
+		matching := 0
+		for i := 1; i < len(ts); i++ {
+			days := int(ts[i].Date.Sub(ts[i-1].Date.Time).Hours() / 24)
+			if days >= lo && days <= hi {
+				matching++
+			}
+		}
+		if float64(matching) < recurringIntervalShare*float64(len(ts)-1) {
+			continue
+		}
+
+		var total money.Amount
+		for _, t := range ts {
+			total += t.Amount
+		}
+		last := ts[len(ts)-1].Date
+		return Recurring{
+			Cadence:      c,
+			Average:      total / money.Amount(len(ts)),
+			Last:         last,
+			Next:         c.Next(last),
+			Transactions: ts,
+		}, true
+	}
+	return Recurring{}, false
+}
+
+// Returns the series' status as of the date.
+func (r Recurring) status(asOf Date) RecurringStatus {
+	grace := r.Cadence.grace()
+	if !asOf.After(r.Next.AddDate(0, 0, grace)) {
+		return Active
+	}
+	// The transaction after the next one is overdue too
+	if asOf.After(r.Cadence.Next(r.Next).AddDate(0, 0, grace)) {
+		return Cancelled
+	}
+	return Missed
+}
+
+// Returns the absolute value of the amount.
+func abs(a money.Amount) money.Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
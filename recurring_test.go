@@ -0,0 +1,107 @@
+package restTest
+
+import (
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Returns n transactions from the company starting on the date and repeating at the cadence.
+func series(company string, amount money.Amount, start string, c Cadence, n int) []Transaction {
+	var ts []Transaction
+	d := newDate(start)
+	for i := 0; i < n; i++ {
+		ts = append(ts, Transaction{d, "", amount, company})
+		d = c.Next(d)
+	}
+	return ts
+}
+
+func TestDetectRecurring(t *testing.T) {
+	var ts []Transaction
+	// Monthly hosting with slightly varying amounts and masked card numbers
+	hosting := series("GROWINGCITY.COM xxxxxx4926 BC", -6301, "2013-01-12", Monthly, 12)
+	hosting[3].Amount = -6501
+	hosting[5].Company = "GROWINGCITY.COM xxxxxx1111 BC"
+	ts = append(ts, hosting...)
+	// Weekly that stopped two months before the end of the data
+	ts = append(ts, series("NESTERS MARKET #x0064 VANCOUVER BC", -9112, "2013-06-01", Weekly, 8)...)
+	// Yearly domain renewal
+	ts = append(ts, series("GANDI.NET", -1500, "2012-03-01", Yearly, 2)...)
+	// One-off purchases at the same merchant as a monthly series
+	ts = append(ts, Transaction{newDate("2013-05-05"), "", -551817, "GROWINGCITY.COM xxxxxx4926 BC"})
+	// Irregular transactions
+	ts = append(ts,
+		Transaction{newDate("2013-01-01"), "", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		Transaction{newDate("2013-01-09"), "", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+		Transaction{newDate("2013-04-20"), "", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"},
+	)
+
+	rs := DetectRecurring(ts, nil, Date{})
+
+	expected := []struct {
+		merchant string
+		cadence  Cadence
+		count    int
+		next     string
+		status   RecurringStatus
+	}{
+		{"GANDI.NET", Yearly, 2, "2014-03-01", Active},
+		{"GROWINGCITY.COM", Monthly, 12, "2014-01-12", Active},
+		{"NESTERS MARKET", Weekly, 8, "2013-07-27", Cancelled},
+	}
+	if len(rs) != len(expected) {
+		t.Fatalf("Expected %d recurring series, got %d:\n%s", len(expected), len(rs), rs)
+	}
+	for i, e := range expected {
+		r := rs[i]
+		if r.Merchant != e.merchant || r.Cadence != e.cadence || len(r.Transactions) != e.count ||
+			r.Next.Format(dateTemplate) != e.next || r.Status != e.status {
+			t.Errorf("Expected %s %s series of %d due %s (%s), got:\n%s", e.merchant, e.cadence, e.count, e.next, e.status, r)
+		}
+	}
+
+	if expected := money.Amount(-6317); rs[1].Average != expected {
+		t.Errorf("Expected average %s, got %s", expected, rs[1].Average)
+	}
+}
+
+func TestDetectRecurringRefunds(t *testing.T) {
+	// Monthly charges with two of them refunded
+	ts := series("SPOTIFY P0123456", -5000, "2013-01-15", Monthly, 12)
+	ts = append(ts,
+		Transaction{newDate("2013-03-20"), "", 5000, "SPOTIFY P0123456"},
+		Transaction{newDate("2013-08-18"), "", 5000, "SPOTIFY P0123456"},
+	)
+
+	rs := DetectRecurring(ts, nil, Date{})
+	if len(rs) != 1 {
+		t.Fatalf("Expected 1 recurring series, got %d:\n%s", len(rs), rs)
+	}
+	if n := len(rs[0].Transactions); n != 12 {
+		t.Errorf("Expected the refunds to be left out of the series of %d charges, got %d transactions", 12, n)
+	}
+	if expected := money.Amount(-5000); rs[0].Average != expected {
+		t.Errorf("Expected average %s, got %s", expected, rs[0].Average)
+	}
+}
+
+func TestRecurringStatus(t *testing.T) {
+	r := Recurring{Cadence: Monthly, Next: newDate("2014-01-12")}
+
+	tests := []struct {
+		asOf     string
+		expected RecurringStatus
+	}{
+		{"2014-01-01", Active},
+		{"2014-01-19", Active},
+		{"2014-01-20", Missed},
+		{"2014-02-19", Missed},
+		{"2014-02-20", Cancelled},
+	}
+	for _, tc := range tests {
+		if actual := r.status(newDate(tc.asOf)); actual != tc.expected {
+			t.Errorf("Expected status %s as of %s, got %s", tc.expected, tc.asOf, actual)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package restTest
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Size of the report's running balance chart, in SVG user units.
+const (
+	reportChartWidth  = 800
+	reportChartHeight = 300
+	// Room for the axis labels around the plot
+	reportChartPadding = 60
+)
+
+// ReportOptions configure an HTML report.
+type ReportOptions struct {
+	// Title of the report. Defaults to "Transactions Report".
+	Title string
+	// Where the transactions were read from. Ex. api, csv:bank.csv
+	Source string
+	// Time the report is generated at. Defaults to now.
+	Generated time.Time
+	// Normalizes companies into merchants. May be nil.
+	Normalizer *Normalizer
+	// Number of top merchants. 0 for all.
+	TopMerchants int
+}
+
+// MonthRollup holds the totals of a month's transactions.
+type MonthRollup struct {
+	// First day of the month.
+	Month    Date
+	Inflows  money.Amount
+	Outflows money.Amount
+	Net      money.Amount
+	// Running balance at the end of the month.
+	Closing money.Amount
+}
+
+// MonthlyRollups returns the totals of each month with transactions, sorted by month.
+func MonthlyRollups(ts []Transaction) []MonthRollup {
+	var (
+		rollups []MonthRollup
+		index   = make(map[Date]int)
+	)
+	db := DailyBalancesFromTransactions(Slice(ts))
+	for _, day := range db.days {
+		m := monthOf(day)
+		if _, ok := index[m]; !ok {
+			index[m] = len(rollups)
+			rollups = append(rollups, MonthRollup{Month: m})
+		}
+		rollups[index[m]].Closing = db.balances[day]
+	}
+	for _, t := range ts {
+		r := &rollups[index[monthOf(t.Date)]]
+		if t.Amount > 0 {
+			r.Inflows += t.Amount
+		} else {
+			r.Outflows += t.Amount
+		}
+		r.Net += t.Amount
+	}
+	return rollups
+}
+
+// The data the report template is executed with.
+type reportData struct {
+	ReportOptions
+	Count     int
+	From, To  string
+	Total     money.Amount
+	Chart     reportChart
+	Daily     []reportDay
+	Months    []MonthRollup
+	Ledgers   []LedgerBalance
+	Merchants MerchantTotals
+}
+
+type reportDay struct {
+	Date    string
+	Change  money.Amount
+	Balance money.Amount
+}
+
+// The running balance chart's polyline points and axis labels.
+type reportChart struct {
+	Width, Height int
+	// Plot area bounds
+	Left, Right, Top, Bottom int
+	// Y of the zero line, if it's in the plot
+	Zero     int
+	HasZero  bool
+	Points   string
+	Min, Max money.Amount
+	From, To string
+}
+
+// WriteHTMLReport writes a self-contained HTML report of the transactions:
+// an SVG chart of the running balances, tables of the daily balances, monthly
+// rollups, ledger breakdowns and top merchants, and when and from what the
+// report was generated. It uses no external stylesheets, scripts or images.
+func WriteHTMLReport(w io.Writer, ts []Transaction, opts ReportOptions) error {
+	if opts.Title == "" {
+		opts.Title = "Transactions Report"
+	}
+	if opts.Generated.IsZero() {
+		opts.Generated = time.Now()
+	}
+
+	data := reportData{
+		ReportOptions: opts,
+		Count:         len(ts),
+		Months:        MonthlyRollups(ts),
+		Merchants:     TopMerchants(ts, opts.Normalizer, opts.TopMerchants),
+	}
+
+	db := DailyBalancesFromTransactions(Slice(ts))
+	var prev money.Amount
+	for _, day := range db.days {
+		b := db.balances[day]
+		data.Daily = append(data.Daily, reportDay{day.Format(dateTemplate), b - prev, b})
+		prev = b
+	}
+	if len(db.days) > 0 {
+		data.From, data.To = db.days[0].Format(dateTemplate), db.days[len(db.days)-1].Format(dateTemplate)
+		data.Total = db.GetRunningBalance()
+	}
+	data.Chart = newReportChart(db)
+
+	lb := LedgerBalancesFromTransactions(Slice(ts))
+	for _, l := range lb.Ledgers() {
+		b, _ := lb.Get(l)
+		data.Ledgers = append(data.Ledgers, b)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
+
+// Returns the chart of the running balances, with days spaced evenly.
+func newReportChart(db DailyBalances) reportChart {
+	c := reportChart{
+		Width:  reportChartWidth,
+		Height: reportChartHeight,
+		Left:   reportChartPadding * 3 / 2,
+		Right:  reportChartWidth - reportChartPadding/2,
+		Top:    reportChartPadding / 2,
+		Bottom: reportChartHeight - reportChartPadding,
+	}
+	if len(db.days) == 0 {
+		return c
+	}
+
+	values := make([]money.Amount, len(db.days))
+	for i, day := range db.days {
+		values[i] = db.balances[day]
+	}
+	c.Min, c.Max = minMax(values)
+	c.From, c.To = db.days[0].Format(dateTemplate), db.days[len(db.days)-1].Format(dateTemplate)
+
+	y := func(v money.Amount) int {
+		if c.Max == c.Min {
+			return (c.Top + c.Bottom) / 2
+		}
+		return c.Bottom - int(int64(v-c.Min)*int64(c.Bottom-c.Top)/int64(c.Max-c.Min))
+	}
+	if c.Min < 0 && c.Max > 0 {
+		c.Zero, c.HasZero = y(0), true
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := c.Left
+		if len(values) > 1 {
+			x += i * (c.Right - c.Left) / (len(values) - 1)
+		}
+		points[i] = fmt.Sprintf("%d,%d", x, y(v))
+	}
+	c.Points = strings.Join(points, " ")
+	return c
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"month":    func(d Date) string { return d.Format("2006-01") },
+	"time":     func(t time.Time) string { return t.Format(time.RFC1123) },
+	"percent":  func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"average":  func(m MerchantTotal) money.Amount { return m.Total / money.Amount(m.Count) },
+	"negative": func(a money.Amount) bool { return a < 0 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.25em 0.75em; border-bottom: 1px solid #ddd; text-align: left; }
+td.amount, th.amount { text-align: right; font-variant-numeric: tabular-nums; }
+.negative { color: #b00; }
+.meta { color: #666; }
+.month td { color: #666; padding-left: 2em; }
+svg text { font-size: 12px; fill: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{time .Generated}}{{with .Source}} from {{.}}{{end}}.
+{{.Count}} transactions{{if .From}} from {{.From}} to {{.To}}{{end}}.
+Total balance: <strong>{{.Total}}</strong>.</p>
+
+<h2>Running Balance</h2>
+{{with .Chart}}{{if .Points}}
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" role="img" aria-label="Running balance chart">
+<line x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}" stroke="#999"/>
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#999"/>
+{{if .HasZero}}<line x1="{{.Left}}" y1="{{.Zero}}" x2="{{.Right}}" y2="{{.Zero}}" stroke="#ccc" stroke-dasharray="4"/>{{end}}
+<text x="{{.Left}}" y="{{.Top}}" dx="-6" dy="4" text-anchor="end">{{.Max}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" dx="-6" dy="4" text-anchor="end">{{.Min}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" dy="20">{{.From}}</text>
+<text x="{{.Right}}" y="{{.Bottom}}" dy="20" text-anchor="end">{{.To}}</text>
+<polyline points="{{.Points}}" fill="none" stroke="#2a6fdb" stroke-width="2"/>
+</svg>
+{{else}}<p>No transactions.</p>{{end}}{{end}}
+
+<h2>Monthly Rollups</h2>
+<table>
+<tr><th>Month</th><th class="amount">Inflows</th><th class="amount">Outflows</th><th class="amount">Net</th><th class="amount">Closing Balance</th></tr>
+{{range .Months}}<tr><td>{{month .Month}}</td><td class="amount">{{.Inflows}}</td><td class="amount{{if negative .Outflows}} negative{{end}}">{{.Outflows}}</td><td class="amount{{if negative .Net}} negative{{end}}">{{.Net}}</td><td class="amount{{if negative .Closing}} negative{{end}}">{{.Closing}}</td></tr>
+{{end}}</table>
+
+<h2>Ledgers</h2>
+<table>
+<tr><th>Ledger</th><th class="amount">Total</th><th class="amount">Share</th><th class="amount">Count</th></tr>
+{{range .Ledgers}}<tr><td>{{.Ledger}}</td><td class="amount{{if negative .Total}} negative{{end}}">{{.Total}}</td><td class="amount">{{percent .Share}}</td><td class="amount">{{.Count}}</td></tr>
+{{range .Months}}<tr class="month"><td>{{month .Month}}</td><td class="amount">{{.Total}}</td><td></td><td></td></tr>
+{{end}}{{end}}</table>
+
+<h2>Top Merchants</h2>
+<table>
+<tr><th>Merchant</th><th class="amount">Total</th><th class="amount">Count</th><th class="amount">Average</th></tr>
+{{range .Merchants}}<tr><td>{{.Merchant}}</td><td class="amount{{if negative .Total}} negative{{end}}">{{.Total}}</td><td class="amount">{{.Count}}</td><td class="amount">{{average .}}</td></tr>
+{{end}}</table>
+
+<h2>Daily Balances</h2>
+<table>
+<tr><th>Date</th><th class="amount">Change</th><th class="amount">Balance</th></tr>
+{{range .Daily}}<tr><td>{{.Date}}</td><td class="amount{{if negative .Change}} negative{{end}}">{{.Change}}</td><td class="amount{{if negative .Balance}} negative{{end}}">{{.Balance}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,81 @@
+package restTest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonthlyRollups(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-15"), "Office Expense", -4253, "FEDEX"},
+		{newDate("2013-11-01"), "", 100000, "DEPOSIT"},
+		{newDate("2013-11-20"), "Office Expense", -1000, "DHL"},
+		{newDate("2013-12-31"), "", 500, "REFUND"},
+	}
+
+	expected := []MonthRollup{
+		{newDate("2013-11-01"), 100000, -1000, 99000, 99000},
+		{newDate("2013-12-01"), 500, -4253, -3753, 95247},
+	}
+	rollups := MonthlyRollups(ts)
+	if len(rollups) != len(expected) {
+		t.Fatalf("Expected %d months, got %v", len(expected), rollups)
+	}
+	for i, e := range expected {
+		if a := rollups[i]; a.Month.Format(dateTemplate) != e.Month.Format(dateTemplate) ||
+			a.Inflows != e.Inflows || a.Outflows != e.Outflows || a.Net != e.Net || a.Closing != e.Closing {
+			t.Errorf("Expected rollup %+v\nGot %+v", e, a)
+		}
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-01"), "", 100000, "DEPOSIT"},
+		{newDate("2013-12-05"), "Office Expense", -4253, "FEDEX <Ship & Co>"},
+		{newDate("2013-12-10"), "Office Expense", -150000, "DHL"},
+	}
+
+	var buf bytes.Buffer
+	err := WriteHTMLReport(&buf, ts, ReportOptions{
+		Source:    "csv:bank.csv",
+		Generated: time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+
+	for _, s := range []string{
+		"<title>Transactions Report</title>",
+		"Generated Thu, 02 Jan 2014 03:04:05 UTC from csv:bank.csv",
+		"3 transactions from 2013-12-01 to 2013-12-10",
+		"Total balance: <strong>-542.53</strong>",
+		// Chart labels and the zero line between them
+		`text-anchor="end">1000.00</text>`,
+		`text-anchor="end">-542.53</text>`,
+		`stroke-dasharray="4"`,
+		`<polyline points="90,30 430,36 770,240"`,
+		// Tables
+		"<td>2013-12</td><td class=\"amount\">1000.00</td>",
+		"<td>Office Expense</td>",
+		"<td>2013-12-10</td><td class=\"amount negative\">-1500.00</td><td class=\"amount negative\">-542.53</td>",
+		// Company names are escaped
+		"FEDEX &lt;SHIP &amp; CO&gt;",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("Expected report to contain %q", s)
+		}
+	}
+	for _, s := range []string{"<script", "<link", "src=", "http://", "https://"} {
+		if s == "http://" {
+			// The SVG namespace is the only URL allowed
+			html = strings.Replace(html, `xmlns="http://www.w3.org/2000/svg"`, "", 1)
+		}
+		if strings.Contains(html, s) {
+			t.Errorf("Expected report not to reference external assets, found %q", s)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package restTest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// ErrNotLoaded is returned by the server's endpoints until the first refresh succeeds.
+var ErrNotLoaded = errors.New("transactions have not been loaded yet")
+
+// Server serves the transactions and their balances as a JSON API:
+//
+//	GET  /balances                          running daily balances
+//	GET  /balances/{date}                   running balance at the end of the date
+//	GET  /transactions?from=&to=&ledger=    transactions, optionally filtered
+//	GET  /total                             total balance
+//	GET  /ledgers                           ledger totals
+//	POST /refresh                           reloads the transactions
+//
+// Responses have an ETag, and requests with a matching If-None-Match get a
+// 304 Not Modified. Errors are returned as {"error": "message"}.
+type Server struct {
+	// Load returns the transactions to serve. It's called on each refresh
+	// with the refresh's span, to start its own spans as children of.
+	Load func(span Span) ([]Transaction, error)
+	// Span the refreshes' spans are children of, ex. a run's. Optional.
+	Span Span
+
+	// Held by Refresh, so a slower load can't replace a newer one
+	refreshMutex sync.Mutex
+	mutex        sync.RWMutex
+	data         *serverData
+}
+
+// The loaded transactions and the balances computed from them.
+type serverData struct {
+	transactions []Transaction
+	daily        DailyBalances
+	ledgers      LedgerBalances
+}
+
+// Balance is a date's running balance as served by Server.
+type Balance struct {
+	Date    Date         `json:"date"`
+	Balance money.Amount `json:"balance"`
+}
+
+// ServedTransaction is a transaction as served by Server.
+type ServedTransaction struct {
+	Date    Date         `json:"date"`
+	Ledger  string       `json:"ledger"`
+	Amount  money.Amount `json:"amount"`
+	Company string       `json:"company"`
+}
+
+// LedgerTotal is a ledger's totals as served by Server.
+type LedgerTotal struct {
+	Ledger string       `json:"ledger"`
+	Total  money.Amount `json:"total"`
+	Count  int          `json:"count"`
+	// Fraction of all outflows, rounded to 4 decimal places.
+	Share float64 `json:"share"`
+}
+
+// Refresh loads the transactions and replaces the ones being served. If
+// loading fails, the server keeps serving the previous ones. Concurrent
+// refreshes run one after the other.
+func (s *Server) Refresh() (err error) {
+	s.refreshMutex.Lock()
+	defer s.refreshMutex.Unlock()
+
+	span := startSpan("refresh", s.Span)
+	defer func() { span.End(err) }()
+
+	ts, err := s.Load(span)
+	if err != nil {
+		return err
+	}
+
+	// Serve the transactions sorted by date without reordering the loaded slice
+	ts = append([]Transaction(nil), ts...)
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].Date.Before(ts[j].Date.Time) })
+
+	data := &serverData{
+		transactions: ts,
+		daily:        DailyBalancesIn(span, Slice(ts)),
+		ledgers:      LedgerBalancesFromTransactions(Slice(ts)),
+	}
+
+	s.mutex.Lock()
+	s.data = data
+	s.mutex.Unlock()
+	return nil
+}
+
+// RefreshEvery refreshes the transactions every interval until ctx is done.
+// Refresh errors are passed to onError, which may be nil.
+func (s *Server) RefreshEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		path   = strings.TrimSuffix(r.URL.Path, "/")
+		method = http.MethodGet
+		h      http.HandlerFunc
+	)
+	switch {
+	case path == "/balances":
+		h = s.handle(s.balances)
+	case strings.HasPrefix(path, "/balances/"):
+		h = s.handle(s.balance)
+	case path == "/transactions":
+		h = s.handle(s.transactions)
+	case path == "/total":
+		h = s.handle(s.total)
+	case path == "/ledgers":
+		h = s.handle(s.ledgerTotals)
+	case path == "/refresh":
+		method, h = http.MethodPost, s.refresh
+	default:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no endpoint at %s", r.URL.Path))
+		return
+	}
+
+	if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		w.Header().Set("Allow", method)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s only accepts %s", r.URL.Path, method))
+		return
+	}
+	h(w, r)
+}
+
+// An endpoint returns the value to respond with, or a requestError.
+type endpoint func(data *serverData, r *http.Request) (interface{}, error)
+
+// requestError is returned by endpoints for requests they can't serve.
+type requestError struct {
+	status int
+	msg    string
+}
+
+// Implements error.
+func (err requestError) Error() string {
+	return err.msg
+}
+
+// Returns a handler that responds with the endpoint's value, or with a 503
+// Service Unavailable if no transactions are loaded.
+func (s *Server) handle(e endpoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.RLock()
+		data := s.data
+		s.mutex.RUnlock()
+		if data == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, ErrNotLoaded)
+			return
+		}
+
+		v, err := e(data, r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var reqErr requestError
+			if errors.As(err, &reqErr) {
+				status = reqErr.status
+			}
+			writeJSONError(w, status, err)
+			return
+		}
+		writeJSON(w, r, v)
+	}
+}
+
+func (s *Server) balances(data *serverData, r *http.Request) (interface{}, error) {
+	bs := make([]Balance, len(data.daily.days))
+	for i, day := range data.daily.days {
+		bs[i] = Balance{day, data.daily.balances[day]}
+	}
+	return bs, nil
+}
+
+// Responds with the running balance of the last day with transactions on or
+// before the date.
+func (s *Server) balance(data *serverData, r *http.Request) (interface{}, error) {
+	v := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/balances/")
+	date, err := ParseDate(v)
+	if err != nil {
+		return nil, requestError{http.StatusBadRequest, fmt.Sprintf("invalid date %q", v)}
+	}
+
+	days := data.daily.days
+	i := sort.Search(len(days), func(i int) bool { return days[i].After(date.Time) })
+	if i == 0 {
+		return nil, requestError{http.StatusNotFound, fmt.Sprintf("no transactions on or before %s", date.Format(dateTemplate))}
+	}
+	return Balance{date, data.daily.balances[days[i-1]]}, nil
+}
+
+// Responds with the transactions between the from and to query dates,
+// inclusive, of the ledger query parameter. All are optional.
+func (s *Server) transactions(data *serverData, r *http.Request) (interface{}, error) {
+	var (
+		q        = r.URL.Query()
+		from, to Date
+		err      error
+	)
+	if v := q.Get("from"); v != "" {
+		if from, err = ParseDate(v); err != nil {
+			return nil, requestError{http.StatusBadRequest, fmt.Sprintf("invalid from %q", v)}
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = ParseDate(v); err != nil {
+			return nil, requestError{http.StatusBadRequest, fmt.Sprintf("invalid to %q", v)}
+		}
+	}
+	_, filterLedger := q["ledger"]
+	ledger := q.Get("ledger")
+
+	ts := []ServedTransaction{}
+	for _, t := range data.transactions {
+		if !from.IsZero() && t.Date.Before(from.Time) ||
+			!to.IsZero() && t.Date.After(to.Time) ||
+			filterLedger && t.Ledger != ledger {
+			continue
+		}
+		ts = append(ts, ServedTransaction{t.Date, t.Ledger, t.Amount, t.Company})
+	}
+	return ts, nil
+}
+
+func (s *Server) total(data *serverData, r *http.Request) (interface{}, error) {
+	var total money.Amount
+	if len(data.daily.days) > 0 {
+		total = data.daily.GetRunningBalance()
+	}
+	return struct {
+		Total money.Amount `json:"total"`
+	}{total}, nil
+}
+
+func (s *Server) ledgerTotals(data *serverData, r *http.Request) (interface{}, error) {
+	ls := []LedgerTotal{}
+	for _, l := range data.ledgers.Ledgers() {
+		b, _ := data.ledgers.Get(l)
+		share := math.Round(b.Share*10000) / 10000
+		if share == 0 {
+			// Not -0 for ledgers without outflows
+			share = 0
+		}
+		ls = append(ls, LedgerTotal{b.Ledger, b.Total, b.Count, share})
+	}
+	return ls, nil
+}
+
+// Reloads the transactions and responds with how many were loaded.
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	if err := s.Refresh(); err != nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+	s.mutex.RLock()
+	n := len(s.data.transactions)
+	s.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Transactions int `json:"transactions"`
+	}{n})
+}
+
+// Writes v as JSON with an ETag of its hash, or a 304 Not Modified if the
+// request's If-None-Match has the same ETag.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(b))
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// Reports whether the If-None-Match header value lists the ETag or is *.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == etag || t == "W/"+etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,158 @@
+package restTest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+func TestServer(t *testing.T) {
+	ts := []Transaction{
+		{newDate("2013-12-05"), "Office Expense", -4253, "FEDEX"},
+		{newDate("2013-12-01"), "", 100000, "DEPOSIT"},
+		{newDate("2013-12-10"), "Travel Expense", -2000, "UBER"},
+	}
+	s := &Server{Load: func(Span) ([]Transaction, error) { return ts, nil }}
+
+	// Nothing to serve before the first refresh
+	if rec := serve(s, "GET", "/total", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d before loading, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/total", 200, `{"total":"937.47"}`},
+		{"GET", "/balances", 200, `[{"date":"2013-12-01","balance":"1000.00"},{"date":"2013-12-05","balance":"957.47"},{"date":"2013-12-10","balance":"937.47"}]`},
+		{"GET", "/balances/2013-12-05", 200, `{"date":"2013-12-05","balance":"957.47"}`},
+		// Days without transactions have the previous day's balance
+		{"GET", "/balances/2013-12-07", 200, `{"date":"2013-12-07","balance":"957.47"}`},
+		{"GET", "/balances/2013-11-30", 404, `{"error":"no transactions on or before 2013-11-30"}`},
+		{"GET", "/balances/yesterday", 400, `{"error":"invalid date \"yesterday\""}`},
+		{"GET", "/transactions?from=2013-12-02&to=2013-12-10", 200, `[{"date":"2013-12-05","ledger":"Office Expense","amount":"-42.53","company":"FEDEX"},{"date":"2013-12-10","ledger":"Travel Expense","amount":"-20.00","company":"UBER"}]`},
+		{"GET", "/transactions?ledger=", 200, `[{"date":"2013-12-01","ledger":"","amount":"1000.00","company":"DEPOSIT"}]`},
+		{"GET", "/transactions?ledger=Rent", 200, `[]`},
+		{"GET", "/transactions?from=12/02/2013", 400, `{"error":"invalid from \"12/02/2013\""}`},
+		{"GET", "/ledgers", 200, `[{"ledger":"Office Expense","total":"-42.53","count":1,"share":0.6802},{"ledger":"Travel Expense","total":"-20.00","count":1,"share":0.3198},{"ledger":"Uncategorized","total":"1000.00","count":1,"share":0}]`},
+		{"POST", "/refresh", 200, `{"transactions":3}`},
+		{"POST", "/total", 405, `{"error":"/total only accepts GET"}`},
+		{"GET", "/refresh", 405, `{"error":"/refresh only accepts POST"}`},
+		{"GET", "/", 404, `{"error":"no endpoint at /"}`},
+	}
+	for _, tc := range tests {
+		rec := serve(s, tc.method, tc.path, "")
+		if rec.Code != tc.status {
+			t.Errorf("Expected %s %s status %d, got %d", tc.method, tc.path, tc.status, rec.Code)
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != tc.body {
+			t.Errorf("Expected %s %s body\n%s\nGot\n%s", tc.method, tc.path, tc.body, body)
+		}
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	ts := []Transaction{{newDate("2013-12-01"), "", 100000, "DEPOSIT"}}
+	s := &Server{Load: func(Span) ([]Transaction, error) { return ts, nil }}
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	etag := serve(s, "GET", "/balances", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tc := range tests {
+		rec := serve(s, "GET", "/balances", tc.ifNoneMatch)
+		if rec.Code != tc.status {
+			t.Errorf("Expected If-None-Match %s status %d, got %d", tc.ifNoneMatch, tc.status, rec.Code)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("Expected no body with 304, got %q", rec.Body)
+		}
+	}
+
+	// New transactions change the ETag, and failed refreshes keep the old ones
+	ts = append(ts, Transaction{newDate("2013-12-02"), "", -100, "FEE"})
+	if rec := serve(s, "POST", "/refresh", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected refresh to succeed, got %d", rec.Code)
+	}
+	if rec := serve(s, "GET", "/balances", etag); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d after the balances changed, got %d", http.StatusOK, rec.Code)
+	}
+
+	s.Load = func(Span) ([]Transaction, error) { return nil, errors.New("connection refused") }
+	if rec := serve(s, "POST", "/refresh", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected failed refresh status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	if body := serve(s, "GET", "/total", "").Body.String(); !strings.Contains(body, "999.00") {
+		t.Errorf("Expected the previous transactions to be served after a failed refresh, got %s", body)
+	}
+}
+
+// Returns the server's response to the request.
+func serve(s *Server, method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServerConcurrentRefresh(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		loads   int
+		loading = make(chan bool)
+		release = make(chan bool)
+	)
+	s := &Server{Load: func(Span) ([]Transaction, error) {
+		mutex.Lock()
+		loads++
+		n := loads
+		mutex.Unlock()
+		if n == 1 {
+			// The first load is slower than the second
+			loading <- true
+			<-release
+		}
+		return []Transaction{{newDate("2013-12-01"), "", money.Amount(n), "DEPOSIT"}}, nil
+	}}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); s.Refresh() }()
+	<-loading
+	// A refresh started while the first one loads waits for it to be served
+	if s.refreshMutex.TryLock() {
+		t.Fatal("Expected the first refresh to hold the refresh mutex while it loads")
+	}
+	go func() { defer wg.Done(); s.Refresh() }()
+	close(release)
+	wg.Wait()
+
+	if body := serve(s, "GET", "/total", "").Body.String(); !strings.Contains(body, `"0.02"`) {
+		t.Errorf("Expected the second load to be served, got %s", body)
+	}
+}
@@ -0,0 +1,299 @@
+package restTest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Source produces transactions in batches. Batches are sent over the channel
+// returned by Transactions, which is closed once all of them have been sent.
+//
+// Like bufio.Scanner, a source stops at the first error it encounters. Call
+// Err after the channel is closed to check whether it read everything.
+type Source interface {
+	// Transactions starts reading and returns the channel of batches.
+	Transactions() chan []Transaction
+	// Err returns the first error the source encountered, if any.
+	Err() error
+}
+
+// Channel is a Source over an existing channel of transaction batches.
+// Its Err method always returns nil.
+type Channel chan []Transaction
+
+// Transactions implements Source.
+func (c Channel) Transactions() chan []Transaction { return c }
+
+// Err implements Source.
+func (c Channel) Err() error { return nil }
+
+// Slice is a Source over transactions already in memory. It sends
+// them in batches the size of an API page.
+type Slice []Transaction
+
+// Transactions implements Source.
+func (s Slice) Transactions() chan []Transaction {
+	ch := make(chan []Transaction)
+	go func() {
+		defer close(ch)
+		sendBatches(ch, s)
+	}()
+	return ch
+}
+
+// Err implements Source.
+func (s Slice) Err() error { return nil }
+
+// ReadAll reads all transactions from the source and returns them
+// along with the source's error, if any.
+func ReadAll(src Source) ([]Transaction, error) {
+	var all []Transaction
+	for ts := range src.Transactions() {
+		all = append(all, ts...)
+	}
+	return all, src.Err()
+}
+
+// Embedded by sources that read in a go routine to record the
+// error the read returns and implement Err.
+type reader struct{ err error }
+
+// Err implements Source.
+func (r *reader) Err() error { return r.err }
+
+// Calls read in a go routine, closing the channel and recording the
+// error when it returns.
+func (r *reader) start(read func(ch chan []Transaction) error) chan []Transaction {
+	ch := make(chan []Transaction)
+	go func() {
+		defer close(ch)
+		r.err = read(ch)
+	}()
+	return ch
+}
+
+// Sends the transactions over the channel in batches of at most
+// transactionsPerPage, the same size as an API page.
+func sendBatches(ch chan []Transaction, ts []Transaction) {
+	for len(ts) > transactionsPerPage {
+		ch <- ts[:transactionsPerPage]
+		ts = ts[transactionsPerPage:]
+	}
+	if len(ts) > 0 {
+		ch <- ts
+	}
+}
+
+// API is a Source that fetches all pages from the restTest API server,
+// like FetchAllTransactions, but reports errors through Err instead of
+// panicking.
+type API struct {
+	reader
+	// Page url template with %d where the page number goes.
+	// Defaults to the restTest API url.
+	URLTemplate string
+	// Number of concurrent go routines that fetch pages. Defaults to Concurrency.
+	Concurrency int
+	// Checkpoint file to save fetched pages to, and to resume from if a previous
+	// fetch was interrupted. Optional. See Checkpoint.
+	Checkpoint string
+	// Span the fetch's spans are children of, ex. a run's. Optional.
+	Span Span
+}
+
+// Transactions implements Source.
+func (a *API) Transactions() chan []Transaction {
+	template, concurrency := a.URLTemplate, a.Concurrency
+	if template == "" {
+		template = urlTemplate
+	}
+	if concurrency < 1 {
+		concurrency = Concurrency
+	}
+	return a.start(func(ch chan []Transaction) error {
+		return fetchAll(a.Span, ch, template, concurrency, a.Checkpoint)
+	})
+}
+
+// PageDir is a Source that reads pages saved as files named {n}.json in Dir,
+// in the same format the API serves them. The first page's totalCount gives
+// the number of pages; a missing page file is an error.
+type PageDir struct {
+	reader
+	Dir string
+}
+
+// Transactions implements Source.
+func (d *PageDir) Transactions() chan []Transaction {
+	return d.start(func(ch chan []Transaction) error {
+		first, err := d.page(1)
+		if err != nil {
+			return err
+		}
+		ch <- first.Transactions
+
+		for n := 2; n <= numPages(first.TotalCount); n++ {
+			page, err := d.page(n)
+			if err != nil {
+				return err
+			}
+			ch <- page.Transactions
+		}
+		return nil
+	})
+}
+
+// Reads the page file n.
+func (d *PageDir) page(n int) (*Page, error) {
+	name := fmt.Sprintf("%d.json", n)
+	f, err := os.Open(filepath.Join(d.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("missing page file %s", name)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	page := new(Page)
+	if err = json.NewDecoder(f).Decode(page); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return page, nil
+}
+
+// JSONFile is a Source that reads a file holding a single JSON array of
+// transactions.
+type JSONFile struct {
+	reader
+	Path string
+}
+
+// Transactions implements Source.
+func (j *JSONFile) Transactions() chan []Transaction {
+	return j.start(func(ch chan []Transaction) error {
+		f, err := os.Open(j.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var ts []Transaction
+		if err = json.NewDecoder(f).Decode(&ts); err != nil {
+			return err
+		}
+		sendBatches(ch, ts)
+		return nil
+	})
+}
+
+// NDJSON is a Source that reads newline delimited JSON, one transaction
+// object per line, from Reader (ex. os.Stdin).
+type NDJSON struct {
+	reader
+	Reader io.Reader
+}
+
+// Transactions implements Source.
+func (n *NDJSON) Transactions() chan []Transaction {
+	return n.start(func(ch chan []Transaction) error {
+		dec := json.NewDecoder(n.Reader)
+		batch := make([]Transaction, 0, transactionsPerPage)
+		for {
+			var t Transaction
+			err := dec.Decode(&t)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			batch = append(batch, t)
+			if len(batch) == transactionsPerPage {
+				ch <- batch
+				batch = make([]Transaction, 0, transactionsPerPage)
+			}
+		}
+		sendBatches(ch, batch)
+		return nil
+	})
+}
+
+// CSVFile is a Source that reads a CSV file. Its first row must be a
+// header naming the Date, Ledger, Amount and Company columns, in any order.
+// Dates use layout 2006-01-02 and amounts are decimal strings (ex. -110.71).
+type CSVFile struct {
+	reader
+	Path string
+}
+
+// Transactions implements Source.
+func (c *CSVFile) Transactions() chan []Transaction {
+	return c.start(func(ch chan []Transaction) error {
+		f, err := os.Open(c.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r := csv.NewReader(f)
+		header, err := r.Read()
+		if err != nil {
+			return err
+		}
+
+		// Map each field to its column index
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		for _, name := range []string{"date", "ledger", "amount", "company"} {
+			if _, ok := columns[name]; !ok {
+				return fmt.Errorf("%s: missing %s column", c.Path, name)
+			}
+		}
+
+		var ts []Transaction
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			line, _ := r.FieldPos(0)
+			t := Transaction{
+				Ledger:  row[columns["ledger"]],
+				Company: row[columns["company"]],
+			}
+			if t.Date, err = ParseDate(row[columns["date"]]); err != nil {
+				return fmt.Errorf("%s:%d: %v", c.Path, line, err)
+			}
+			if t.Amount, err = money.Parse(row[columns["amount"]]); err != nil {
+				return fmt.Errorf("%s:%d: %v", c.Path, line, err)
+			}
+			ts = append(ts, t)
+		}
+		sendBatches(ch, ts)
+		return nil
+	})
+}
+
+// WriteCSV writes the transactions as a CSV file with a Date, Ledger,
+// Amount and Company header, the format CSVFile reads.
+func WriteCSV(w io.Writer, ts []Transaction) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Date", "Ledger", "Amount", "Company"})
+	for _, t := range ts {
+		cw.Write([]string{t.Date.Format(dateTemplate), t.Ledger, t.Amount.String(), t.Company})
+	}
+	cw.Flush()
+	return cw.Error()
+}
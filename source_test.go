@@ -0,0 +1,189 @@
+package restTest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Reads all transactions from the source and fails the test if it errors.
+func readAll(t *testing.T, src Source) []Transaction {
+	var all []Transaction
+	for ts := range src.Transactions() {
+		if n := len(ts); n > transactionsPerPage {
+			t.Errorf("Expected batches of at most %d transactions, got %d", transactionsPerPage, n)
+		}
+		all = append(all, ts...)
+	}
+	if err := src.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+// Writes the content to a file named name in a temporary directory and returns its path.
+func writeTemp(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAPISource(t *testing.T) {
+	handler := restTestHandler{http.StatusOK, 35, nil}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	all := readAll(t, &API{URLTemplate: mockServer.URL + "/%d"})
+	if n := len(all); n != 40 {
+		t.Errorf("Expected %d transactions, got %d", 40, n)
+	}
+
+	// Errors are reported by Err instead of panicking
+	handler.status = http.StatusInternalServerError
+	src := &API{URLTemplate: mockServer.URL + "/%d"}
+	for range src.Transactions() {
+	}
+	if e, ok := src.Err().(HTTPError); !ok || e.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected HTTPError with status %d, got %v", http.StatusInternalServerError, src.Err())
+	}
+}
+
+func TestPageDirSource(t *testing.T) {
+	dir := t.TempDir()
+	for n := 1; n <= 3; n++ {
+		page := fmt.Sprintf(mockPageStr, 30, n)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.json", n)), []byte(page), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := readAll(t, &PageDir{Dir: dir})
+	if n := len(all); n != 30 {
+		t.Errorf("Expected %d transactions, got %d", 30, n)
+	}
+
+	// A missing page is an error naming its file
+	if err := os.Remove(filepath.Join(dir, "2.json")); err != nil {
+		t.Fatal(err)
+	}
+	src := &PageDir{Dir: dir}
+	for range src.Transactions() {
+	}
+	if err := src.Err(); err == nil || !strings.Contains(err.Error(), "2.json") {
+		t.Errorf("Expected an error naming the missing 2.json, got %v", err)
+	}
+
+	// An empty directory has no first page
+	src = &PageDir{Dir: t.TempDir()}
+	for range src.Transactions() {
+	}
+	if src.Err() == nil {
+		t.Error("Expected reading an empty page directory to fail")
+	}
+}
+
+func TestJSONFileSource(t *testing.T) {
+	path := writeTemp(t, "transactions.json", `[
+		{"Date": "2013-12-22", "Ledger": "Phone & Internet Expense", "Amount": "-110.71", "Company": "SHAW CABLESYSTEMS CALGARY AB"},
+		{"Date": "2013-12-21", "Ledger": "", "Amount": "1000", "Company": "PAYMENT"}
+	]`)
+
+	all := readAll(t, &JSONFile{Path: path})
+	if n := len(all); n != 2 {
+		t.Fatalf("Expected %d transactions, got %d", 2, n)
+	}
+	if a := all[0].Amount.String(); a != "-110.71" {
+		t.Errorf("Expected amount %s, got %s", "-110.71", a)
+	}
+}
+
+func TestNDJSONSource(t *testing.T) {
+	var lines []string
+	for i := 0; i < 25; i++ {
+		lines = append(lines, fmt.Sprintf(`{"Date": "2013-12-%02d", "Ledger": "Office Expense", "Amount": "-1.00", "Company": "FEDEX"}`, i+1))
+	}
+
+	all := readAll(t, &NDJSON{Reader: strings.NewReader(strings.Join(lines, "\n"))})
+	if n := len(all); n != 25 {
+		t.Errorf("Expected %d transactions, got %d", 25, n)
+	}
+
+	src := &NDJSON{Reader: strings.NewReader(`{"Date": "2013-12-40"}`)}
+	for range src.Transactions() {
+	}
+	if src.Err() == nil {
+		t.Error("Expected an invalid date to fail")
+	}
+}
+
+func TestCSVFileSource(t *testing.T) {
+	path := writeTemp(t, "transactions.csv", "Company,Date,Amount,Ledger\n"+
+		"\"DHL YVR GW RICHMOND BC\",2013-12-12,-30.69,Postage & Shipping Expense\n"+
+		"\"FEDEX xxxxx5291 MISSISSAUGA ON\",2013-12-12,-42.53,Office Expense\n")
+
+	all := readAll(t, &CSVFile{Path: path})
+	if n := len(all); n != 2 {
+		t.Fatalf("Expected %d transactions, got %d", 2, n)
+	}
+	expected := Transaction{newDate("2013-12-12"), "Office Expense", -4253, "FEDEX xxxxx5291 MISSISSAUGA ON"}
+	if a := all[1]; a.String() != expected.String() {
+		t.Errorf("Expected transaction %v\nGot %v", expected, a)
+	}
+
+	tests := []string{
+		"Date,Amount,Company\n2013-12-12,-30.69,DHL\n",
+		"Date,Ledger,Amount,Company\n2013-12-12,Office,abc,DHL\n",
+	}
+	for _, content := range tests {
+		src := &CSVFile{Path: writeTemp(t, "invalid.csv", content)}
+		for range src.Transactions() {
+		}
+		if src.Err() == nil {
+			t.Errorf("Expected reading %q to fail", content)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	ts := []Transaction{{newDate("2013-12-12"), "Office Expense", -4253, "FEDEX, MISSISSAUGA ON"}}
+
+	var b strings.Builder
+	if err := WriteCSV(&b, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	all := readAll(t, &CSVFile{Path: writeTemp(t, "transactions.csv", b.String())})
+	if len(all) != 1 || all[0].String() != ts[0].String() {
+		t.Errorf("Expected transactions %v\nGot %v", ts, all)
+	}
+}
+
+func TestSliceSource(t *testing.T) {
+	ts := make([]Transaction, 25)
+	all, err := ReadAll(Slice(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(all); n != 25 {
+		t.Errorf("Expected %d transactions, got %d", 25, n)
+	}
+}
+
+func TestDailyBalancesFromSource(t *testing.T) {
+	path := writeTemp(t, "transactions.json", `[
+		{"Date": "2013-12-22", "Amount": "-10.00"},
+		{"Date": "2013-12-21", "Amount": "20.00"},
+		{"Date": "2013-12-22", "Amount": "-5.50"}
+	]`)
+
+	db := DailyBalancesFromTransactions(&JSONFile{Path: path})
+	if expected := "2013-12-21:\t20.00\n2013-12-22:\t4.50"; db.String() != expected {
+		t.Errorf("Expected daily balances:\n%s\nGot:\n%s", expected, db)
+	}
+}
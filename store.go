@@ -0,0 +1,570 @@
+package restTest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// Identifies store files. It's followed by the format version.
+	storeMagic = "RTSTORE"
+	// Version of the store file format.
+	storeVersion = 1
+	// Seconds in a day, to encode dates as days since the Unix epoch.
+	secondsPerDay = 24 * 60 * 60
+)
+
+// Store is an embedded store of transactions, sorted by date and indexed by
+// ledger and company. Queries on a date range, optionally of a ledger or a
+// company, find their transactions with binary searches, and their count and
+// total with prefix sums, without going over the transactions.
+//
+// Stores are saved in a compact binary format:
+//
+//	the magic and version         RTSTORE, 1 byte version
+//	the strings                   uvarint count, then uvarint length and bytes of each ledger and company
+//	the transactions              uvarint count, then for each, in date order:
+//	                              varint days since the previous transaction (since the Unix epoch for the first),
+//	                              varint amount in cents, uvarint ledger and company string indexes
+//	the sync state                1 byte, 1 if a SyncStore saved the file and its state follows, else 0:
+//	                              uvarint length and bytes of the url template, uvarint total count,
+//	                              varint time of the last sync in Unix nanoseconds, uvarint page count,
+//	                              then uvarint count and indexes of each page's transactions
+//	the checksum                  CRC-32 (IEEE) of everything before it, big endian
+//
+// The indexes are built when a store is read. A Store is safe for concurrent
+// queries, but not for queries concurrent with Add.
+type Store struct {
+	transactions []Transaction
+	// Total of the transactions before each index
+	sums      []money.Amount
+	ledgers   map[string]*postings
+	companies map[string]*postings
+}
+
+// postings are the indexes of the transactions of a ledger or a company,
+// in date order, with the total of the transactions before each of them.
+type postings struct {
+	indexes []int
+	sums    []money.Amount
+}
+
+// Query selects transactions. Its zero fields match all transactions.
+type Query struct {
+	// First and last dates, inclusive.
+	From, To Date
+	Ledger   string
+	Company  string
+}
+
+// Aggregate is the number of transactions a query matches, and their total.
+type Aggregate struct {
+	Count int
+	Total money.Amount
+}
+
+// Group is the aggregate of the transactions with the same key.
+type Group struct {
+	// Ledger, company, day (2006-01-02) or month (2006-01).
+	Key string
+	Aggregate
+}
+
+// Groups are aggregates of transactions grouped by a key.
+type Groups []Group
+
+// Returns the groups formatted as a table.
+func (gs Groups) String() string {
+	s := []string{fmt.Sprintf("%-40s %12s %6s", "Key", "Total", "Count")}
+	for _, g := range gs {
+		s = append(s, fmt.Sprintf("%-40s %12s %6d", g.Key, g.Total, g.Count))
+	}
+	return strings.Join(s, "\n")
+}
+
+// NewStore returns a store of the transactions.
+func NewStore(ts []Transaction) *Store {
+	s := &Store{}
+	s.Add(ts...)
+	return s
+}
+
+// Add adds the transactions to the store and rebuilds its indexes.
+// Transactions on the same day stay in the order they were added in.
+func (s *Store) Add(ts ...Transaction) {
+	s.transactions = append(s.transactions, ts...)
+	sort.SliceStable(s.transactions, func(i, j int) bool {
+		return s.transactions[i].Date.Before(s.transactions[j].Date.Time)
+	})
+	s.index()
+}
+
+// Builds the prefix sums and the ledger and company postings.
+func (s *Store) index() {
+	s.sums = make([]money.Amount, len(s.transactions)+1)
+	s.ledgers = make(map[string]*postings)
+	s.companies = make(map[string]*postings)
+	for i, t := range s.transactions {
+		s.sums[i+1] = s.sums[i] + t.Amount
+		addPosting(s.ledgers, t.Ledger, i, t.Amount)
+		addPosting(s.companies, t.Company, i, t.Amount)
+	}
+}
+
+func addPosting(index map[string]*postings, key string, i int, amount money.Amount) {
+	p, ok := index[key]
+	if !ok {
+		p = &postings{sums: []money.Amount{0}}
+		index[key] = p
+	}
+	p.indexes = append(p.indexes, i)
+	p.sums = append(p.sums, p.sums[len(p.sums)-1]+amount)
+}
+
+// Len returns the number of transactions in the store.
+func (s *Store) Len() int {
+	return len(s.transactions)
+}
+
+// Transactions returns all transactions in date order.
+func (s *Store) Transactions() []Transaction {
+	return append([]Transaction(nil), s.transactions...)
+}
+
+// Ledgers returns the ledgers in alphabetical order.
+func (s *Store) Ledgers() []string {
+	return sortedKeys(s.ledgers)
+}
+
+// Companies returns the companies in alphabetical order.
+func (s *Store) Companies() []string {
+	return sortedKeys(s.companies)
+}
+
+func sortedKeys(index map[string]*postings) []string {
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the range [lo, hi) of positions in the sorted slice of n
+// transactions, given by date(i), that are within the query's dates.
+func (q Query) dateRange(n int, date func(i int) Date) (lo, hi int) {
+	if !q.From.IsZero() {
+		lo = sort.Search(n, func(i int) bool { return !date(i).Before(q.From.Time) })
+	}
+	hi = n
+	if !q.To.IsZero() {
+		hi = sort.Search(n, func(i int) bool { return date(i).After(q.To.Time) })
+	}
+	return lo, max(lo, hi)
+}
+
+// Returns the postings to look the query up in: the smallest of the ledger's
+// and company's, or nil to look it up in all transactions. ok is false if
+// no transactions have the ledger or company.
+func (s *Store) postings(q Query) (p *postings, ok bool) {
+	if q.Ledger != "" {
+		if p, ok = s.ledgers[q.Ledger]; !ok {
+			return nil, false
+		}
+	}
+	if q.Company != "" {
+		c, ok := s.companies[q.Company]
+		if !ok {
+			return nil, false
+		}
+		if p == nil || len(c.indexes) < len(p.indexes) {
+			p = c
+		}
+	}
+	return p, true
+}
+
+// Calls f with the index of each transaction the query matches, in date order.
+func (s *Store) each(q Query, f func(i int)) {
+	p, ok := s.postings(q)
+	if !ok {
+		return
+	}
+	if p == nil {
+		lo, hi := q.dateRange(len(s.transactions), func(i int) Date { return s.transactions[i].Date })
+		for i := lo; i < hi; i++ {
+			f(i)
+		}
+		return
+	}
+	lo, hi := q.dateRange(len(p.indexes), func(i int) Date { return s.transactions[p.indexes[i]].Date })
+	for _, i := range p.indexes[lo:hi] {
+		t := s.transactions[i]
+		if (q.Ledger == "" || t.Ledger == q.Ledger) && (q.Company == "" || t.Company == q.Company) {
+			f(i)
+		}
+	}
+}
+
+// Find returns the transactions the query matches in date order.
+func (s *Store) Find(q Query) []Transaction {
+	var ts []Transaction
+	s.each(q, func(i int) { ts = append(ts, s.transactions[i]) })
+	return ts
+}
+
+// Sum returns the number and total of the transactions the query matches.
+// Unless the query has both a ledger and a company, it takes O(log n) time.
+func (s *Store) Sum(q Query) Aggregate {
+	p, ok := s.postings(q)
+	switch {
+	case !ok:
+		return Aggregate{}
+	case p == nil:
+		lo, hi := q.dateRange(len(s.transactions), func(i int) Date { return s.transactions[i].Date })
+		return Aggregate{hi - lo, s.sums[hi] - s.sums[lo]}
+	case q.Ledger == "" || q.Company == "":
+		lo, hi := q.dateRange(len(p.indexes), func(i int) Date { return s.transactions[p.indexes[i]].Date })
+		return Aggregate{hi - lo, p.sums[hi] - p.sums[lo]}
+	}
+
+	var a Aggregate
+	s.each(q, func(i int) {
+		a.Count++
+		a.Total += s.transactions[i].Amount
+	})
+	return a
+}
+
+// GroupBy returns the aggregates of the transactions the query matches
+// grouped by ledger, company, day or month. Ledgers and companies are in
+// alphabetical order, and days and months in date order.
+func (s *Store) GroupBy(q Query, by string) (Groups, error) {
+	var gs Groups
+	switch by {
+	case "ledger", "company":
+		keys, field := s.Ledgers(), &q.Ledger
+		if by == "company" {
+			keys, field = s.Companies(), &q.Company
+		}
+		if *field != "" {
+			keys = []string{*field}
+		}
+		for _, k := range keys {
+			*field = k
+			if a := s.Sum(q); a.Count > 0 {
+				gs = append(gs, Group{k, a})
+			}
+		}
+	case "day", "month":
+		layout := dateTemplate
+		if by == "month" {
+			layout = "2006-01"
+		}
+		s.each(q, func(i int) {
+			t := s.transactions[i]
+			k := t.Date.Format(layout)
+			if len(gs) == 0 || gs[len(gs)-1].Key != k {
+				gs = append(gs, Group{Key: k})
+			}
+			gs[len(gs)-1].Count++
+			gs[len(gs)-1].Total += t.Amount
+		})
+	default:
+		return nil, fmt.Errorf("can't group by %q: must be ledger, company, day or month", by)
+	}
+	return gs, nil
+}
+
+// DailyBalances returns the running daily balances of the transactions in the
+// store. It reads them from the prefix sums at the end of each day.
+func (s *Store) DailyBalances() DailyBalances {
+	db := DailyBalances{balances: make(map[Date]money.Amount)}
+	for i, t := range s.transactions {
+		if i+1 < len(s.transactions) && s.transactions[i+1].Date.Equal(t.Date.Time) {
+			continue
+		}
+		db.days = append(db.days, t.Date)
+		db.balances[t.Date] = s.sums[i+1]
+	}
+	return db
+}
+
+// The state of a SyncStore saved with the transactions of a store.
+type syncState struct {
+	urlTemplate string
+	totalCount  int
+	synced      time.Time
+	// Indexes of each page's transactions in the store, in page order.
+	pages [][]int
+}
+
+// WriteTo writes the store to w in the store file format.
+// Implements io.WriterTo.
+func (s *Store) WriteTo(w io.Writer) (int64, error) {
+	return s.writeTo(w, nil)
+}
+
+// Writes the store with the sync state, which may be nil.
+func (s *Store) writeTo(w io.Writer, state *syncState) (int64, error) {
+	var (
+		b   bytes.Buffer
+		buf [binary.MaxVarintLen64]byte
+		ids = make(map[string]uint64)
+	)
+	putUvarint := func(v uint64) { b.Write(buf[:binary.PutUvarint(buf[:], v)]) }
+	putVarint := func(v int64) { b.Write(buf[:binary.PutVarint(buf[:], v)]) }
+
+	b.WriteString(storeMagic)
+	b.WriteByte(storeVersion)
+
+	// The strings table, with each ledger and company once
+	var strs []string
+	for _, t := range s.transactions {
+		for _, str := range []string{t.Ledger, t.Company} {
+			if _, ok := ids[str]; !ok {
+				ids[str] = uint64(len(strs))
+				strs = append(strs, str)
+			}
+		}
+	}
+	putUvarint(uint64(len(strs)))
+	for _, str := range strs {
+		putUvarint(uint64(len(str)))
+		b.WriteString(str)
+	}
+
+	putUvarint(uint64(len(s.transactions)))
+	var prev int64
+	for _, t := range s.transactions {
+		day := daysSinceEpoch(t.Date)
+		putVarint(day - prev)
+		prev = day
+		putVarint(int64(t.Amount))
+		putUvarint(ids[t.Ledger])
+		putUvarint(ids[t.Company])
+	}
+
+	if state == nil {
+		b.WriteByte(0)
+	} else {
+		b.WriteByte(1)
+		putUvarint(uint64(len(state.urlTemplate)))
+		b.WriteString(state.urlTemplate)
+		putUvarint(uint64(state.totalCount))
+		putVarint(state.synced.UnixNano())
+		putUvarint(uint64(len(state.pages)))
+		for _, page := range state.pages {
+			putUvarint(uint64(len(page)))
+			for _, i := range page {
+				putUvarint(uint64(i))
+			}
+		}
+	}
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(b.Bytes()))
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// Returns the number of days from the Unix epoch to the date, rounded down.
+func daysSinceEpoch(d Date) int64 {
+	secs := d.Unix()
+	day := secs / secondsPerDay
+	if secs%secondsPerDay < 0 {
+		day--
+	}
+	return day
+}
+
+// ReadStore reads a store in the store file format from r.
+func ReadStore(r io.Reader) (*Store, error) {
+	s, _, err := readStore(r)
+	return s, err
+}
+
+// Reads a store and its sync state, which is nil if the file has none.
+func readStore(r io.Reader) (*Store, *syncState, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < len(storeMagic)+1+4 || string(data[:len(storeMagic)]) != storeMagic {
+		return nil, nil, errors.New("not a store file")
+	}
+	if v := data[len(storeMagic)]; v != storeVersion {
+		return nil, nil, fmt.Errorf("unsupported store version %d", v)
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, nil, errors.New("store file is corrupt: checksum mismatch")
+	}
+
+	d := storeDecoder{b: body[len(storeMagic)+1:]}
+	strs := make([]string, d.uvarint())
+	for i := range strs {
+		strs[i] = string(d.bytes(d.uvarint()))
+	}
+	str := func(id uint64) string {
+		if id >= uint64(len(strs)) {
+			d.fail()
+			return ""
+		}
+		return strs[id]
+	}
+
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		// Each transaction takes at least a byte per field
+		d.fail()
+	}
+	s := &Store{transactions: make([]Transaction, 0, min(n, uint64(len(d.b))))}
+	var day int64
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		day += d.varint()
+		t := Transaction{
+			Date:   Date{time.Unix(day*secondsPerDay, 0).UTC()},
+			Amount: money.Amount(d.varint()),
+		}
+		t.Ledger, t.Company = str(d.uvarint()), str(d.uvarint())
+		s.transactions = append(s.transactions, t)
+	}
+
+	state := d.syncState(len(s.transactions))
+	if d.err == nil && len(d.b) > 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	s.index()
+	return s, state, nil
+}
+
+// storeDecoder decodes the fields of a store file, keeping the first error.
+type storeDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *storeDecoder) fail() {
+	if d.err == nil {
+		d.err = errors.New("store file is corrupt")
+	}
+	d.b = nil
+}
+
+func (d *storeDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *storeDecoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *storeDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.b)) {
+		d.fail()
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+// Decodes the sync state, or returns nil if there's none. n is the number of
+// transactions in the store, which the pages' indexes must be less than.
+func (d *storeDecoder) syncState(n int) *syncState {
+	flag := d.bytes(1)
+	if len(flag) == 0 || flag[0] == 0 {
+		return nil
+	} else if flag[0] != 1 {
+		d.fail()
+		return nil
+	}
+
+	state := &syncState{
+		urlTemplate: string(d.bytes(d.uvarint())),
+		totalCount:  int(d.uvarint()),
+		synced:      time.Unix(0, d.varint()),
+	}
+	pages := d.uvarint()
+	for p := uint64(0); p < pages && d.err == nil; p++ {
+		size := d.uvarint()
+		if size > uint64(len(d.b)) {
+			// Each index takes at least a byte
+			d.fail()
+			break
+		}
+		page := make([]int, size)
+		for i := range page {
+			if page[i] = int(d.uvarint()); page[i] >= n {
+				d.fail()
+			}
+		}
+		state.pages = append(state.pages, page)
+	}
+	return state
+}
+
+// LoadStore reads the store saved at path.
+func LoadStore(path string) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ReadStore(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the store to path with writeFileAtomic.
+func (s *Store) Save(path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := s.WriteTo(w)
+		return err
+	})
+}
+
+// StoreFile is a Source that reads the transactions of a store saved at Path.
+type StoreFile struct {
+	reader
+	Path string
+}
+
+// Transactions implements Source.
+func (f *StoreFile) Transactions() chan []Transaction {
+	return f.start(func(ch chan []Transaction) error {
+		s, err := LoadStore(f.Path)
+		if err != nil {
+			return err
+		}
+		sendBatches(ch, s.transactions)
+		return nil
+	})
+}
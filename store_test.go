@@ -0,0 +1,238 @@
+package restTest
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Returns transactions across 3 ledgers and 7 companies, in no particular order.
+func storeTransactions() []Transaction {
+	ts := makeTransactions(0, 100)
+	ledgers := []string{"Office Expense", "Insurance Expense", "Equipment Expense"}
+	for i := range ts {
+		ts[i].Ledger = ledgers[i%3]
+		ts[i].Company = "COMPANY " + string(rune('A'+i%7))
+	}
+	return ts
+}
+
+// Returns the transactions the query matches by going over all of them.
+func filterTransactions(ts []Transaction, q Query) (matched []Transaction) {
+	for _, t := range ts {
+		if !q.From.IsZero() && t.Date.Before(q.From.Time) ||
+			!q.To.IsZero() && t.Date.After(q.To.Time) ||
+			q.Ledger != "" && t.Ledger != q.Ledger ||
+			q.Company != "" && t.Company != q.Company {
+			continue
+		}
+		matched = append(matched, t)
+	}
+	return matched
+}
+
+func mustParseDate(t *testing.T, s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestStoreQueries(t *testing.T) {
+	ts := storeTransactions()
+	s := NewStore(ts)
+	sorted := s.Transactions()
+
+	queries := []Query{
+		{},
+		{From: mustParseDate(t, "2013-12-10")},
+		{To: mustParseDate(t, "2013-12-10")},
+		{From: mustParseDate(t, "2013-12-05"), To: mustParseDate(t, "2013-12-05")},
+		{From: mustParseDate(t, "2013-12-20"), To: mustParseDate(t, "2013-12-10")},
+		{Ledger: "Insurance Expense"},
+		{Ledger: "Insurance Expense", From: mustParseDate(t, "2013-12-03"), To: mustParseDate(t, "2013-12-17")},
+		{Company: "COMPANY C", To: mustParseDate(t, "2013-12-15")},
+		{Ledger: "Office Expense", Company: "COMPANY D"},
+		{Ledger: "Office Expense", Company: "COMPANY D", From: mustParseDate(t, "2013-12-13")},
+		{Ledger: "Rent Expense"},
+		{Company: "NOBODY"},
+	}
+	for _, q := range queries {
+		expected := filterTransactions(sorted, q)
+		if actual := s.Find(q); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%+v: Expected transactions %v, got %v", q, expected, actual)
+		}
+
+		var sum Aggregate
+		for _, t := range expected {
+			sum.Count++
+			sum.Total += t.Amount
+		}
+		if actual := s.Sum(q); actual != sum {
+			t.Errorf("%+v: Expected aggregate %+v, got %+v", q, sum, actual)
+		}
+	}
+
+	if n := s.Len(); n != len(ts) {
+		t.Errorf("Expected %d transactions, got %d", len(ts), n)
+	}
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Date.Before(sorted[i-1].Date.Time) {
+			t.Fatalf("Expected transactions in date order, got %v before %v", sorted[i-1], sorted[i])
+		}
+	}
+	if expected := []string{"Equipment Expense", "Insurance Expense", "Office Expense"}; !reflect.DeepEqual(s.Ledgers(), expected) {
+		t.Errorf("Expected ledgers %v, got %v", expected, s.Ledgers())
+	}
+	if n := len(s.Companies()); n != 7 {
+		t.Errorf("Expected 7 companies, got %d", n)
+	}
+
+	// Added transactions are indexed
+	s.Add(Transaction{Date: mustParseDate(t, "2013-12-05"), Ledger: "Rent Expense", Amount: -100000, Company: "LANDLORD"})
+	if a := s.Sum(Query{Ledger: "Rent Expense"}); a != (Aggregate{1, -100000}) {
+		t.Errorf("Expected the added transaction's aggregate, got %+v", a)
+	}
+}
+
+func TestStoreGroupBy(t *testing.T) {
+	s := NewStore(storeTransactions())
+
+	tests := []struct {
+		by       string
+		query    Query
+		expected Groups
+	}{
+		{"ledger", Query{To: mustParseDate(t, "2013-12-02")}, Groups{
+			{"Equipment Expense", Aggregate{2, -8700}},
+			{"Insurance Expense", Aggregate{3, -11700}},
+			{"Office Expense", Aggregate{3, -14400}},
+		}},
+		{"company", Query{Ledger: "Office Expense", To: mustParseDate(t, "2013-12-02")}, Groups{
+			{"COMPANY A", Aggregate{2, -8600}},
+			{"COMPANY B", Aggregate{1, -5800}},
+		}},
+		{"day", Query{From: mustParseDate(t, "2013-12-27")}, Groups{
+			{"2013-12-27", Aggregate{3, -16500}},
+			{"2013-12-28", Aggregate{3, -16800}},
+		}},
+		{"month", Query{}, Groups{
+			{"2013-12", Aggregate{100, -505000}},
+		}},
+	}
+	for _, test := range tests {
+		actual, err := s.GroupBy(test.query, test.by)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("By %s: Expected groups\n%s\ngot\n%s", test.by, test.expected, actual)
+		}
+	}
+
+	if _, err := s.GroupBy(Query{}, "year"); err == nil {
+		t.Errorf("Expected an error grouping by year")
+	}
+}
+
+func TestGroupsString(t *testing.T) {
+	gs := Groups{{"Office Expense", Aggregate{5, -17100}}, {"Insurance Expense", Aggregate{1, -3000}}}
+	expected := strings.Join([]string{
+		"Key                                             Total  Count",
+		"Office Expense                                -171.00      5",
+		"Insurance Expense                              -30.00      1",
+	}, "\n")
+	if actual := gs.String(); actual != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestStoreDailyBalances(t *testing.T) {
+	ts := storeTransactions()
+	expected := DailyBalancesFromTransactions(Slice(ts)).String()
+	if actual := NewStore(ts).DailyBalances().String(); actual != expected {
+		t.Errorf("Expected daily balances\n%s\ngot\n%s", expected, actual)
+	}
+	if db := NewStore(nil).DailyBalances(); len(db.days) != 0 {
+		t.Errorf("Expected no daily balances of an empty store, got %v", db)
+	}
+}
+
+func TestStoreEncoding(t *testing.T) {
+	ts := append(storeTransactions(), Transaction{Ledger: "No Date", Amount: money.Amount(5), Company: "ünïcode"})
+	s := NewStore(ts)
+
+	var b bytes.Buffer
+	n, err := s.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", b.Len(), n)
+	}
+	// The JSON encoding of a transaction alone takes more than 60 bytes
+	if perTransaction := b.Len() / len(ts); perTransaction > 10 {
+		t.Errorf("Expected at most 10 bytes per transaction, got %d", perTransaction)
+	}
+	encoded := b.Bytes()
+
+	read, err := ReadStore(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Transactions(), s.Transactions()) {
+		t.Errorf("Expected transactions %v, got %v", s.Transactions(), read.Transactions())
+	}
+	if a := read.Sum(Query{Company: "ünïcode"}); a != (Aggregate{1, 5}) {
+		t.Errorf("Expected the read store to be indexed, got %+v", a)
+	}
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), encoded...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a store file"},
+		{"json", []byte(`{"transactions": []}`), "not a store file"},
+		{"version", corrupt(func(b []byte) []byte { b[len(storeMagic)] = 2; return b }), "unsupported store version 2"},
+		{"flipped bit", corrupt(func(b []byte) []byte { b[20] ^= 1; return b }), "checksum mismatch"},
+		{"truncated", corrupt(func(b []byte) []byte { return b[:len(b)/2] }), "checksum mismatch"},
+	}
+	for _, test := range tests {
+		_, err := ReadStore(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestStoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transactions.db")
+	ts := storeTransactions()
+	if err := NewStore(ts).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Len(); n != len(ts) {
+		t.Errorf("Expected %d transactions, got %d", len(ts), n)
+	}
+	if all := readAll(t, &StoreFile{Path: path}); len(all) != len(ts) {
+		t.Errorf("Expected %d transactions from the source, got %d", len(ts), len(all))
+	}
+
+	if _, err := LoadStore(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Errorf("Expected an error loading a missing store")
+	}
+}
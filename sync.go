@@ -0,0 +1,361 @@
+package restTest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+const (
+	// DefaultSyncSample is the default number of earlier pages a sync
+	// refetches to detect changed transactions.
+	DefaultSyncSample = 5
+)
+
+// SyncStore is a local copy of the API's transactions, by page, with the
+// hash of each page and the daily totals, so that a sync only needs to fetch
+// the pages that could have changed. It's saved as a store file with the
+// sync state, so LoadStore and StoreFile read its transactions as a Store.
+// It's not safe for concurrent use.
+type SyncStore struct {
+	// Url template of the synced pages, and their total count.
+	URLTemplate string
+	TotalCount  int
+	// When the last sync finished.
+	Synced time.Time
+
+	pages  [][]Transaction
+	hashes []string
+	daily  map[Date]dayTotal
+}
+
+// A day's number of transactions and their sum.
+type dayTotal struct {
+	count  int
+	amount money.Amount
+}
+
+// SyncOptions configures a sync.
+type SyncOptions struct {
+	// Number of pages before the last synced page to refetch, chosen at
+	// random, to detect changed transactions. Page 1 is always refetched.
+	Sample int
+	// Number of concurrent go routines that fetch pages. Defaults to Concurrency.
+	Concurrency int
+	// Span the sync's spans are children of, ex. a run's. Optional.
+	Span Span
+}
+
+// SyncResult summarizes what a sync fetched and changed.
+type SyncResult struct {
+	// Pages fetched, and how many of them changed since the last sync.
+	Fetched, Changed int
+	// Transactions added and removed.
+	Added, Removed int
+	// Whether all pages were fetched, because the store was empty, the total
+	// count went down or a page before the last synced one changed.
+	Full bool
+}
+
+// Returns the result formatted as a line. Ex.
+// fetched 7 pages, 2 changed: 15 transactions added, 8 removed
+func (r SyncResult) String() string {
+	s := fmt.Sprintf("fetched %d pages, %d changed: %d transactions added, %d removed", r.Fetched, r.Changed, r.Added, r.Removed)
+	if r.Full {
+		s += " (full sync)"
+	}
+	return s
+}
+
+// NewSyncStore returns an empty store.
+func NewSyncStore() *SyncStore {
+	return &SyncStore{daily: make(map[Date]dayTotal)}
+}
+
+// LoadSyncStore reads the store saved at path. It returns an empty store if
+// there's no file at path, and an error if the file is a store without sync
+// state.
+func LoadSyncStore(path string) (*SyncStore, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return NewSyncStore(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store, state, err := readStore(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if state == nil {
+		return nil, fmt.Errorf("%s: the store wasn't saved by a sync", path)
+	}
+
+	s := NewSyncStore()
+	s.URLTemplate, s.TotalCount, s.Synced = state.urlTemplate, state.totalCount, state.synced
+	for _, page := range state.pages {
+		ts := make([]Transaction, len(page))
+		for j, i := range page {
+			ts[j] = store.transactions[i]
+		}
+		s.pages = append(s.pages, ts)
+		s.hashes = append(s.hashes, hashTransactions(ts))
+		s.add(ts)
+	}
+	return s, nil
+}
+
+// Save writes the store to path as a store file with the sync state, with
+// writeFileAtomic.
+func (s *SyncStore) Save(path string) error {
+	all := s.Transactions()
+	// Indexes of the transactions in date order, like a Store keeps them
+	order := make([]int, len(all))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return all[order[i]].Date.Before(all[order[j]].Date.Time) })
+
+	store := &Store{transactions: make([]Transaction, len(all))}
+	position := make([]int, len(all))
+	for p, i := range order {
+		store.transactions[p] = all[i]
+		position[i] = p
+	}
+
+	state := &syncState{s.URLTemplate, s.TotalCount, s.Synced, make([][]int, len(s.pages))}
+	k := 0
+	for i, ts := range s.pages {
+		state.pages[i] = position[k : k+len(ts)]
+		k += len(ts)
+	}
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := store.writeTo(w, state)
+		return err
+	})
+}
+
+// Transactions returns the synced transactions in page order.
+func (s *SyncStore) Transactions() []Transaction {
+	var all []Transaction
+	for _, ts := range s.pages {
+		all = append(all, ts...)
+	}
+	return all
+}
+
+// DailyBalances returns the running daily balances of the synced
+// transactions. It's calculated from the daily totals the syncs keep
+// up to date, without going over the transactions.
+func (s *SyncStore) DailyBalances() DailyBalances {
+	db := DailyBalances{days: s.days(), balances: make(map[Date]money.Amount, len(s.daily))}
+	for day, t := range s.daily {
+		db.balances[day] = t.amount
+	}
+	db.setRunningDailyBalances()
+	return db
+}
+
+// Returns the days with transactions in ascending order.
+func (s *SyncStore) days() []Date {
+	days := make([]Date, 0, len(s.daily))
+	for day := range s.daily {
+		days = append(days, day)
+	}
+	byDate(days).Sort()
+	return days
+}
+
+// Sync fetches the pages that could have changed since the last sync and
+// updates the store with them: the first page, the pages from the last
+// synced one to the new last page, and a sample of the pages in between.
+// If any page before the last synced one changed, the transactions may have
+// been rewritten, so it fetches all pages. The daily totals are updated with
+// the changed pages' transactions only.
+//
+// The url template defaults to the restTest API url. If fetching fails, the
+// store is left unchanged.
+func (s *SyncStore) Sync(template string, opts SyncOptions) (result SyncResult, err error) {
+	if template == "" {
+		template = urlTemplate
+	}
+	span := startSpan("sync", opts.Span)
+	span.SetAttributes(slog.String("urlTemplate", template))
+	defer func() {
+		span.SetAttributes(slog.Int("fetched", result.Fetched), slog.Int("changed", result.Changed), slog.Bool("full", result.Full))
+		span.End(err)
+	}()
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = Concurrency
+	}
+
+	start := time.Now()
+	first, n, err := fetchPageIn(span, pageURL(1, template))
+	if err != nil {
+		return result, err
+	}
+	totalCount := first.TotalCount
+	validatePage(first, 1, totalCount)
+	pageCount := numPages(totalCount)
+	fetched := map[int]*Page{1: first}
+
+	// Fetches the pages into fetched. The first page's progress is reported
+	// once the number of pages to fetch is known.
+	var (
+		mutex     sync.Mutex
+		progress  = newProgressTracker(start)
+		firstOnce sync.Once
+	)
+	fetch := func(pages []int) error {
+		progress.setTotal(len(fetched) + len(pages))
+		firstOnce.Do(func() { progress.add(n) })
+		return fetchPages(span, template, pages, totalCount, concurrency, progress, func(i int, p *Page) error {
+			mutex.Lock()
+			fetched[i] = p
+			mutex.Unlock()
+			return nil
+		})
+	}
+
+	// Pages synced from another url don't line up with these
+	synced := len(s.pages)
+	if s.URLTemplate != template {
+		synced = 0
+	}
+	result.Full = synced == 0 || totalCount < s.TotalCount
+
+	if !result.Full {
+		// The last synced page may have had room for more transactions
+		var toFetch []int
+		for i := max(synced, 2); i <= pageCount; i++ {
+			toFetch = append(toFetch, i)
+		}
+		toFetch = append(toFetch, samplePages(synced, opts.Sample)...)
+		if err := fetch(toFetch); err != nil {
+			return result, err
+		}
+
+		for i, p := range fetched {
+			if i < synced && hashTransactions(p.Transactions) != s.hashes[i-1] {
+				Logger.Warn("page changed since the last sync, fetching all pages", "page", i)
+				result.Full = true
+				break
+			}
+		}
+	}
+
+	if result.Full {
+		var toFetch []int
+		for i := 2; i <= pageCount; i++ {
+			if fetched[i] == nil {
+				toFetch = append(toFetch, i)
+			}
+		}
+		if err := fetch(toFetch); err != nil {
+			return result, err
+		}
+	}
+	result.Fetched = len(fetched)
+
+	if synced == 0 {
+		*s = *NewSyncStore()
+	}
+	s.apply(fetched, pageCount, &result)
+	s.URLTemplate, s.TotalCount, s.Synced = template, totalCount, time.Now()
+
+	Logger.Info("synced", "totalCount", totalCount, "fetched", result.Fetched, "changed", result.Changed,
+		"added", result.Added, "removed", result.Removed, "full", result.Full)
+	return result, nil
+}
+
+// Replaces the pages whose transactions changed with the fetched ones, and
+// removes the pages after the last one, updating the daily totals.
+func (s *SyncStore) apply(fetched map[int]*Page, pageCount int, result *SyncResult) {
+	for len(s.pages) < pageCount {
+		s.pages = append(s.pages, nil)
+		s.hashes = append(s.hashes, "")
+	}
+	for i := 1; i <= pageCount; i++ {
+		p, ok := fetched[i]
+		if !ok {
+			continue
+		}
+		hash := hashTransactions(p.Transactions)
+		if hash == s.hashes[i-1] {
+			continue
+		}
+		result.Changed++
+		result.Removed += s.subtract(s.pages[i-1])
+		result.Added += s.add(p.Transactions)
+		s.pages[i-1], s.hashes[i-1] = p.Transactions, hash
+	}
+	for _, ts := range s.pages[pageCount:] {
+		result.Removed += s.subtract(ts)
+	}
+	s.pages, s.hashes = s.pages[:pageCount], s.hashes[:pageCount]
+}
+
+// Adds the transactions to the daily totals and returns how many there are.
+func (s *SyncStore) add(ts []Transaction) int {
+	for _, t := range ts {
+		d := s.daily[t.Date]
+		s.daily[t.Date] = dayTotal{d.count + 1, d.amount + t.Amount}
+	}
+	return len(ts)
+}
+
+// Subtracts the transactions from the daily totals, dropping the days left
+// without any, and returns how many there are.
+func (s *SyncStore) subtract(ts []Transaction) int {
+	for _, t := range ts {
+		d := s.daily[t.Date]
+		if d.count <= 1 {
+			delete(s.daily, t.Date)
+			continue
+		}
+		s.daily[t.Date] = dayTotal{d.count - 1, d.amount - t.Amount}
+	}
+	return len(ts)
+}
+
+// Returns up to n random pages between page 2 and the last synced page,
+// which are neither the first page nor in the tail that's always fetched.
+func samplePages(synced, n int) []int {
+	candidates := synced - 2
+	if candidates <= 0 || n <= 0 {
+		return nil
+	}
+	pages := rand.Perm(candidates)
+	if n < len(pages) {
+		pages = pages[:n]
+	}
+	for i := range pages {
+		pages[i] += 2
+	}
+	return pages
+}
+
+// Returns the hex sha1 of the transactions as JSON, which changes if any of
+// them, or their order, changes.
+func hashTransactions(ts []Transaction) string {
+	if ts == nil {
+		ts = []Transaction{}
+	}
+	b, _ := json.Marshal(ts)
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,299 @@
+package restTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mujz/restTest/money"
+)
+
+// Serves transactions in pages like the restTest API, and records the pages requested.
+type transactionsHandler struct {
+	mutex        sync.Mutex
+	transactions []Transaction
+	requests     []int
+}
+
+func (h *transactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	n, err := strconv.Atoi(strings.Trim(r.URL.Path, "/"))
+	if err != nil {
+		panic(err)
+	}
+	h.requests = append(h.requests, n)
+	start, end := (n-1)*transactionsPerPage, n*transactionsPerPage
+	if start >= len(h.transactions) && n > 1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(Page{
+		TotalCount:   len(h.transactions),
+		Page:         n,
+		Transactions: h.transactions[start:min(end, len(h.transactions))],
+	})
+}
+
+// Returns the pages requested in ascending order, and forgets them.
+func (h *transactionsHandler) takeRequests() []int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	rs := h.requests
+	h.requests = nil
+	sort.Ints(rs)
+	return rs
+}
+
+// Returns n transactions on days of December 2013, starting with the ith.
+func makeTransactions(i, n int) []Transaction {
+	ts := make([]Transaction, n)
+	for j := range ts {
+		k := i + j
+		ts[j] = Transaction{
+			Date:    Date{time.Date(2013, 12, k%28+1, 0, 0, 0, 0, time.UTC)},
+			Ledger:  "Office Expense",
+			Amount:  money.Amount(-(k + 1) * 100),
+			Company: fmt.Sprintf("COMPANY %d", k),
+		}
+	}
+	return ts
+}
+
+func TestSync(t *testing.T) {
+	handler := &transactionsHandler{transactions: makeTransactions(0, 25)}
+	mockServer := httptest.NewServer(handler)
+	defer mockServer.Close()
+	template := mockServer.URL + "/%d"
+
+	// Asserts the store has the handler's transactions and their balances
+	assertSynced := func(s *SyncStore) {
+		t.Helper()
+		if !reflect.DeepEqual(s.Transactions(), handler.transactions) {
+			t.Errorf("Expected transactions %v, got %v", handler.transactions, s.Transactions())
+		}
+		expected := DailyBalancesFromTransactions(Slice(handler.transactions)).String()
+		if actual := s.DailyBalances().String(); actual != expected {
+			t.Errorf("Expected daily balances\n%s\ngot\n%s", expected, actual)
+		}
+		if s.TotalCount != len(handler.transactions) {
+			t.Errorf("Expected total count %d, got %d", len(handler.transactions), s.TotalCount)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func()
+		sample   int
+		requests []int
+		result   SyncResult
+	}{
+		{
+			name:     "empty store",
+			change:   func() {},
+			requests: []int{1, 2, 3},
+			result:   SyncResult{Fetched: 3, Changed: 3, Added: 25, Full: true},
+		},
+		{
+			name:     "unchanged",
+			change:   func() {},
+			requests: []int{1, 3},
+			result:   SyncResult{Fetched: 2},
+		},
+		{
+			name: "appended",
+			change: func() {
+				handler.transactions = append(handler.transactions, makeTransactions(25, 12)...)
+			},
+			requests: []int{1, 3, 4},
+			result:   SyncResult{Fetched: 3, Changed: 2, Added: 17, Removed: 5},
+		},
+		{
+			name: "rewritten",
+			change: func() {
+				handler.transactions[15].Amount = 1000
+			},
+			sample:   5,
+			requests: []int{1, 2, 3, 4},
+			result:   SyncResult{Fetched: 4, Changed: 1, Added: 10, Removed: 10, Full: true},
+		},
+		{
+			name: "removed",
+			change: func() {
+				handler.transactions = handler.transactions[:18]
+			},
+			requests: []int{1, 2},
+			result:   SyncResult{Fetched: 2, Changed: 1, Added: 8, Removed: 27, Full: true},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "transactions.db")
+	for _, test := range tests {
+		handler.mutex.Lock()
+		test.change()
+		handler.mutex.Unlock()
+
+		// Each sync starts from the store the previous one saved
+		s, err := LoadSyncStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := s.Sync(template, SyncOptions{Sample: test.sample, Concurrency: 2})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if result != test.result {
+			t.Errorf("%s: Expected result %+v, got %+v", test.name, test.result, result)
+		}
+		if requests := handler.takeRequests(); !reflect.DeepEqual(requests, test.requests) {
+			t.Errorf("%s: Expected requests for pages %v, got %v", test.name, test.requests, requests)
+		}
+		assertSynced(s)
+		if err := s.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed sync leaves the store as it was
+	s, err := LoadSyncStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.URLTemplate != template || s.Synced.IsZero() {
+		t.Errorf("Expected the sync state saved, got url template %q synced %v", s.URLTemplate, s.Synced)
+	}
+	mockServer.Close()
+	if _, err := s.Sync(template, SyncOptions{}); err == nil {
+		t.Errorf("Expected an error syncing from a closed server")
+	}
+	assertSynced(s)
+}
+
+func TestSyncStoreFile(t *testing.T) {
+	// Pages in descending date order, like the API serves them
+	ts := makeTransactions(0, 25)
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].Date.After(ts[j].Date.Time) })
+	handler := &transactionsHandler{transactions: ts}
+	mockServer := httptest.NewServer(handler)
+	defer mockServer.Close()
+
+	path := filepath.Join(t.TempDir(), "transactions.db")
+	s := NewSyncStore()
+	if _, err := s.Sync(mockServer.URL+"/%d", SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The saved sync store is a store of the same transactions
+	store, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := NewStore(ts).Transactions(); !reflect.DeepEqual(store.Transactions(), expected) {
+		t.Errorf("Expected store transactions %v, got %v", expected, store.Transactions())
+	}
+	loaded, err := LoadSyncStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Transactions(), ts) || !reflect.DeepEqual(loaded.hashes, s.hashes) {
+		t.Errorf("Expected the pages to be loaded as they were synced, got %v", loaded.Transactions())
+	}
+	if !loaded.Synced.Equal(s.Synced) || loaded.TotalCount != 25 {
+		t.Errorf("Expected synced %v with total count 25, got %v with %d", s.Synced, loaded.Synced, loaded.TotalCount)
+	}
+
+	// A store saved without sync state can't be synced
+	if err := NewStore(ts).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSyncStore(path); err == nil || !strings.Contains(err.Error(), "wasn't saved by a sync") {
+		t.Errorf("Expected an error loading a store without sync state, got %v", err)
+	}
+}
+
+func TestSyncProgressAndSpans(t *testing.T) {
+	handler := &transactionsHandler{transactions: makeTransactions(0, 25)}
+	mockServer := httptest.NewServer(handler)
+	defer mockServer.Close()
+
+	var updates []FetchProgress
+	defer func() { Progress = nil }()
+	Progress = func(p FetchProgress) { updates = append(updates, p) }
+	buf := traceTo(t)
+
+	if _, err := NewSyncStore().Sync(mockServer.URL+"/%d", SyncOptions{Concurrency: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 3 || !updates[2].Done() || updates[2].TotalPages != 3 {
+		t.Errorf("Expected progress of 3 pages, got %v", updates)
+	}
+
+	spans := decodeSpans(t, buf)
+	names := make(map[string]string)
+	for _, s := range spans {
+		names[s.SpanID] = s.Name
+	}
+	pagesInFanOut := 0
+	for _, s := range spans {
+		if s.Name == "fetch page" && names[s.ParentSpanID] == "fan-out" {
+			pagesInFanOut++
+		}
+	}
+	if pagesInFanOut != 2 {
+		t.Errorf("Expected 2 pages fetched in a fan-out span, got %d", pagesInFanOut)
+	}
+}
+
+func TestSamplePages(t *testing.T) {
+	tests := []struct {
+		synced, n int
+		expected  int
+	}{
+		{0, 5, 0},
+		{2, 5, 0},
+		{4, 5, 2},
+		{100, 5, 5},
+		{100, 0, 0},
+	}
+	for _, test := range tests {
+		pages := samplePages(test.synced, test.n)
+		if len(pages) != test.expected {
+			t.Errorf("Expected %d pages sampled of %d, got %v", test.expected, test.synced, pages)
+		}
+		seen := make(map[int]bool)
+		for _, p := range pages {
+			if p < 2 || p >= test.synced || seen[p] {
+				t.Errorf("Expected distinct pages from 2 to %d, got %v", test.synced-1, pages)
+			}
+			seen[p] = true
+		}
+	}
+}
+
+func TestSyncResultString(t *testing.T) {
+	tests := []struct {
+		result   SyncResult
+		expected string
+	}{
+		{SyncResult{Fetched: 3, Changed: 2, Added: 17, Removed: 5}, "fetched 3 pages, 2 changed: 17 transactions added, 5 removed"},
+		{SyncResult{Fetched: 3, Changed: 3, Added: 25, Full: true}, "fetched 3 pages, 3 changed: 25 transactions added, 0 removed (full sync)"},
+	}
+	for _, test := range tests {
+		if actual := test.result.String(); actual != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package restTest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Tracer starts spans that time the phases of a run.
+type Tracer interface {
+	// Start starts a span named name. parent is nil for a root span.
+	Start(name string, parent Span) Span
+}
+
+// Span times a phase of a run. Its methods must be safe to call concurrently.
+type Span interface {
+	// SetAttributes adds attributes describing the phase to the span.
+	SetAttributes(attrs ...slog.Attr)
+	// End ends the span. err is the error the phase failed with, or nil.
+	End(err error)
+}
+
+// Tracing is the tracer that times fetches and aggregations.
+// It's a NoopTracer by default.
+var Tracing Tracer = NoopTracer{}
+
+// StartRun starts a root span for a run. Pass it as the Span of the run's
+// sources and syncs, and to DailyBalancesIn, to make their spans its children.
+func StartRun(name string, attrs ...slog.Attr) Span {
+	s := Tracing.Start(name, nil)
+	s.SetAttributes(attrs...)
+	return s
+}
+
+// Starts a span with Tracing. parent is nil for a root span.
+func startSpan(name string, parent Span) Span {
+	return Tracing.Start(name, parent)
+}
+
+// NoopTracer is a Tracer whose spans do nothing.
+type NoopTracer struct{}
+
+// Start implements Tracer.
+func (NoopTracer) Start(name string, parent Span) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...slog.Attr) {}
+func (noopSpan) End(err error)                    {}
+
+// JSONTracer is a Tracer that writes each span as a line of JSON when it
+// ends, with the OpenTelemetry trace and span ID formats. Ex.
+//
+//	{"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174","parentSpanId":"eee19b7ec3c1b173",
+//	"name":"fetch page","startTime":"2013-12-13T10:00:00.1Z","endTime":"2013-12-13T10:00:00.3Z","durationMs":200,
+//	"attributes":{"bytes":1250,"status":200},"status":"ok"}
+type JSONTracer struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+	err   error
+}
+
+// NewJSONTracer returns a tracer that writes spans to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing a span, if any.
+func (t *JSONTracer) Err() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.err
+}
+
+// Start implements Tracer. Spans of other tracers are treated as root spans.
+func (t *JSONTracer) Start(name string, parent Span) Span {
+	s := &jsonSpan{
+		tracer: t,
+		record: spanRecord{
+			Name:       name,
+			SpanID:     randomID(8),
+			StartTime:  time.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+	}
+	if p, ok := parent.(*jsonSpan); ok {
+		s.record.TraceID, s.record.ParentSpanID = p.record.TraceID, p.record.SpanID
+	} else {
+		s.record.TraceID = randomID(16)
+	}
+	return s
+}
+
+// Writes the span, keeping the first error.
+func (t *JSONTracer) write(r spanRecord) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.enc.Encode(r); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+type jsonSpan struct {
+	tracer *JSONTracer
+	mutex  sync.Mutex
+	ended  bool
+	record spanRecord
+}
+
+// The span as JSONTracer writes it.
+type spanRecord struct {
+	TraceID      string                 `json:"traceId"`
+	SpanID       string                 `json:"spanId"`
+	ParentSpanID string                 `json:"parentSpanId,omitempty"`
+	Name         string                 `json:"name"`
+	StartTime    time.Time              `json:"startTime"`
+	EndTime      time.Time              `json:"endTime"`
+	DurationMs   float64                `json:"durationMs"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	// ok or error
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s *jsonSpan) SetAttributes(attrs ...slog.Attr) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, a := range attrs {
+		s.record.Attributes[a.Key] = a.Value.Resolve().Any()
+	}
+}
+
+// Ends the span and writes it. Ending it again does nothing.
+func (s *jsonSpan) End(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+
+	r := &s.record
+	r.EndTime = time.Now()
+	r.DurationMs = float64(r.EndTime.Sub(r.StartTime).Microseconds()) / 1000
+	r.Status = "ok"
+	if err != nil {
+		r.Status, r.Error = "error", err.Error()
+	}
+	for k, v := range r.Attributes {
+		// Durations as strings, not nanoseconds
+		if d, ok := v.(time.Duration); ok {
+			r.Attributes[k] = d.String()
+		}
+	}
+	s.tracer.write(*r)
+}
+
+// Returns n random bytes hex encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
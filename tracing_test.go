@@ -0,0 +1,193 @@
+package restTest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Sets Tracing to a JSONTracer for the test and returns its output.
+func traceTo(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := Tracing
+	Tracing = NewJSONTracer(&buf)
+	t.Cleanup(func() { Tracing = old })
+	return &buf
+}
+
+// Decodes the spans written by a JSONTracer.
+func decodeSpans(t *testing.T, buf *bytes.Buffer) []spanRecord {
+	var spans []spanRecord
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var s spanRecord
+		if err := dec.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func TestTraceRun(t *testing.T) {
+	handler := restTestHandler{status: http.StatusOK, totalCount: 30}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	buf := traceTo(t)
+	run := StartRun("run")
+	ts, err := ReadAll(&API{URLTemplate: mockServer.URL + "/%d", Concurrency: 2, Span: run})
+	if err != nil {
+		t.Fatal(err)
+	}
+	DailyBalancesIn(run, Slice(ts))
+	run.End(nil)
+
+	spans := decodeSpans(t, buf)
+	byID := make(map[string]spanRecord)
+	for _, s := range spans {
+		byID[s.SpanID] = s
+	}
+	// Returns the names of the span's ancestors, from the root
+	path := func(s spanRecord) string {
+		names := []string{s.Name}
+		for s.ParentSpanID != "" {
+			p, ok := byID[s.ParentSpanID]
+			if !ok {
+				t.Fatalf("Expected parent of %s to be written", s.Name)
+			}
+			names = append([]string{p.Name}, names...)
+			s = p
+		}
+		return strings.Join(names, " > ")
+	}
+
+	paths := make(map[string]int)
+	for _, s := range spans {
+		if s.TraceID != spans[0].TraceID {
+			t.Errorf("Expected all spans in one trace, got %s and %s", s.TraceID, spans[0].TraceID)
+		}
+		if s.Status != "ok" || s.EndTime.Before(s.StartTime) {
+			t.Errorf("Expected %s to end successfully after it started, got %+v", s.Name, s)
+		}
+		paths[path(s)]++
+	}
+	expected := map[string]int{
+		"run":                                1,
+		"run > fetch":                        1,
+		"run > fetch > fetch page":           1,
+		"run > fetch > fan-out":              1,
+		"run > fetch > fan-out > fetch page": 2,
+		"run > daily balances":               1,
+		"run > daily balances > accumulate":  1,
+		"run > daily balances > sort":        1,
+		"run > daily balances > running sum": 1,
+	}
+	for p, n := range expected {
+		if paths[p] != n {
+			t.Errorf("Expected %d %q spans, got %d", n, p, paths[p])
+		}
+	}
+	if len(paths) != len(expected) {
+		t.Errorf("Expected only spans %v, got %v", expected, paths)
+	}
+
+	for _, s := range spans {
+		switch s.Name {
+		case "fetch":
+			if s.Attributes["pages"] != float64(3) || s.Attributes["transactions"] != float64(30) {
+				t.Errorf("Expected fetch of 3 pages and 30 transactions, got %v", s.Attributes)
+			}
+		case "fetch page":
+			if s.Attributes["status"] != float64(200) || s.Attributes["bytes"] == nil {
+				t.Errorf("Expected page fetched with status 200 and its size, got %v", s.Attributes)
+			}
+		}
+	}
+}
+
+func TestTraceConcurrentRuns(t *testing.T) {
+	handler := restTestHandler{status: http.StatusOK, totalCount: 30}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	buf := traceTo(t)
+	runs := []Span{StartRun("a"), StartRun("b")}
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run Span) {
+			defer wg.Done()
+			ReadAll(&API{URLTemplate: mockServer.URL + "/%d", Concurrency: 2, Span: run})
+		}(run)
+	}
+	wg.Wait()
+	// Ending a run doesn't change the other's children
+	runs[0].End(nil)
+	DailyBalancesIn(runs[1], Slice(nil))
+	runs[1].End(nil)
+
+	spans := decodeSpans(t, buf)
+	roots := make(map[string]string)
+	for _, s := range spans {
+		if s.ParentSpanID == "" {
+			roots[s.TraceID] = s.Name
+		}
+	}
+	counts := make(map[string]int)
+	for _, s := range spans {
+		counts[roots[s.TraceID]]++
+	}
+	// Each run has itself, a fetch, a fan-out and 3 page fetches, and b the
+	// daily balances and its 3 phases
+	if counts["a"] != 6 || counts["b"] != 10 || len(roots) != 2 {
+		t.Errorf("Expected 6 spans in trace a and 10 in trace b, got %v", counts)
+	}
+}
+
+func TestTraceError(t *testing.T) {
+	handler := restTestHandler{status: http.StatusInternalServerError}
+	mockServer := httptest.NewServer(&handler)
+	defer mockServer.Close()
+
+	buf := traceTo(t)
+	if _, err := fetchPage(mockServer.URL + "/1"); err == nil {
+		t.Fatal("Expected fetch to fail")
+	}
+	spans := decodeSpans(t, buf)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.ParentSpanID != "" {
+		t.Errorf("Expected a root span without a run, got parent %s", s.ParentSpanID)
+	}
+	if s.Status != "error" || !strings.Contains(s.Error, "500") {
+		t.Errorf("Expected span to end with the 500 error, got %s %q", s.Status, s.Error)
+	}
+	if len(s.TraceID) != 32 || len(s.SpanID) != 16 {
+		t.Errorf("Expected 16 byte trace and 8 byte span IDs in hex, got %s and %s", s.TraceID, s.SpanID)
+	}
+}
+
+func TestJSONTracerErr(t *testing.T) {
+	tracer := NewJSONTracer(failingWriter{})
+	s := tracer.Start("run", nil)
+	s.End(nil)
+	// Ending again doesn't write the span again
+	s.End(errors.New("ignored"))
+	if err := tracer.Err(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected write error disk full, got %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}